@@ -0,0 +1,164 @@
+// Command admin performs user, permission and token maintenance directly against the database.
+//
+// Every command writes its result as JSON to stdout and errors as JSON to stderr, so it can be scripted.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/ricci2511/greenlight-api/internal/data"
+)
+
+const usage = `usage: admin [-db-dsn DSN] [-db-query-timeout DURATION] <command> [arguments]
+
+commands:
+  user create -name NAME -email EMAIL [-password PASSWORD] [-roles viewer,...] [-activated]
+  user activate EMAIL
+  user deactivate EMAIL
+  user list
+  perm grant EMAIL CODE...
+  perm revoke EMAIL CODE...
+  tokens purge
+
+The password is read from stdin when -password is omitted.
+`
+
+type envelope map[string]any
+
+// Holds dependencies shared by all commands.
+type application struct {
+	models data.Models
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+type command func(app *application, ctx context.Context, args []string) error
+
+var commands = map[string]command{
+	"user create":     (*application).createUser,
+	"user activate":   (*application).activateUser,
+	"user deactivate": (*application).deactivateUser,
+	"user list":       (*application).listUsers,
+	"perm grant":      (*application).grantPermissions,
+	"perm revoke":     (*application).revokePermissions,
+	"tokens purge":    (*application).purgeTokens,
+}
+
+// Returned by commands for invalid input, reported together with the validator errors.
+type validationError struct {
+	errors map[string]string
+}
+
+func (e *validationError) Error() string {
+	keys := make([]string, 0, len(e.errors))
+	for key, message := range e.errors {
+		keys = append(keys, key+" "+message)
+	}
+	sort.Strings(keys)
+
+	return "invalid input: " + strings.Join(keys, ", ")
+}
+
+func main() {
+	dsn := os.Getenv("GREENLIGHT_DB_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("DATABASE_DSN")
+	}
+
+	flag.StringVar(&dsn, "db-dsn", dsn, "PostgreSQL DSN (env GREENLIGHT_DB_DSN)")
+	queryTimeout := flag.Duration("db-query-timeout", 3*time.Second, "Timeout of a single PostgreSQL query")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 || commands[args[0]+" "+args[1]] == nil {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Cancel running queries on Ctrl+C.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	db, err := openDb(ctx, dsn)
+	if err != nil {
+		exitWithError(err)
+	}
+	defer db.Close()
+
+	app := &application{
+		models: data.NewModels(db, *queryTimeout),
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+	}
+
+	err = commands[args[0]+" "+args[1]](app, ctx, args[2:])
+	if err != nil {
+		db.Close()
+		exitWithError(err)
+	}
+}
+
+func openDb(ctx context.Context, dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		return nil, errors.New("db-dsn must be provided")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Helper to write a command result as indented JSON.
+func (app *application) writeJSON(data envelope) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	_, err = app.stdout.Write(js)
+	return err
+}
+
+// Writes the error as JSON to stderr and exits with a non-zero status.
+func exitWithError(err error) {
+	body := envelope{"error": err.Error()}
+
+	var validationErr *validationError
+	if errors.As(err, &validationErr) {
+		body["error"] = validationErr.errors
+	}
+
+	js, _ := json.MarshalIndent(body, "", "\t")
+	fmt.Fprintln(os.Stderr, string(js))
+
+	os.Exit(1)
+}
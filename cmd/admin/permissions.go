@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ricci2511/greenlight-api/internal/data"
+	"github.com/ricci2511/greenlight-api/internal/validator"
+)
+
+func (app *application) grantPermissions(ctx context.Context, args []string) error {
+	return app.changePermissions(ctx, args, app.models.Permissions.AddForUser)
+}
+
+func (app *application) revokePermissions(ctx context.Context, args []string) error {
+	return app.changePermissions(ctx, args, app.models.Permissions.RemoveForUser)
+}
+
+// Helper to grant or revoke permission codes of a user, writing the user's effective permissions afterwards.
+func (app *application) changePermissions(ctx context.Context, args []string, change func(context.Context, int64, ...string) error) error {
+	if len(args) < 2 {
+		return errors.New("expected an email address followed by one or more permission codes")
+	}
+
+	email, codes := args[0], args[1:]
+
+	err := app.checkPermissionsExist(ctx, codes)
+	if err != nil {
+		return err
+	}
+
+	user, err := app.getUser(ctx, app.models, email)
+	if err != nil {
+		return err
+	}
+
+	err = change(ctx, user.ID, codes...)
+	if err != nil {
+		return err
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return app.writeJSON(envelope{"user": user, "permissions": permissions})
+}
+
+// Checks that every permission code exists, since granting an unknown code is silently ignored by the model.
+func (app *application) checkPermissionsExist(ctx context.Context, codes []string) error {
+	permissions, err := app.models.Permissions.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing := make(data.Permissions, len(permissions))
+	for i, permission := range permissions {
+		existing[i] = permission.Code
+	}
+
+	v := validator.New()
+
+	for _, code := range codes {
+		v.Check(existing.Include(code), "codes", fmt.Sprintf("%q does not exist", code))
+	}
+
+	if !v.Valid() {
+		return &validationError{errors: v.Errors}
+	}
+
+	return nil
+}
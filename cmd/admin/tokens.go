@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// Deletes expired tokens of every scope, which are otherwise kept in the tokens table forever.
+func (app *application) purgeTokens(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errors.New("tokens purge takes no arguments")
+	}
+
+	deleted, err := app.models.Tokens.DeleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	return app.writeJSON(envelope{"deleted": deleted})
+}
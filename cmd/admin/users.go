@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ricci2511/greenlight-api/internal/data"
+	"github.com/ricci2511/greenlight-api/internal/validator"
+)
+
+func (app *application) createUser(ctx context.Context, args []string) error {
+	var (
+		name, email, plaintextPassword, roles string
+		activated                             bool
+	)
+
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	fs.StringVar(&name, "name", "", "Name of the user")
+	fs.StringVar(&email, "email", "", "Email address of the user")
+	fs.StringVar(&plaintextPassword, "password", "", "Password of the user, read from stdin if omitted")
+	fs.StringVar(&roles, "roles", "viewer", "Comma separated roles assigned to the user")
+	fs.BoolVar(&activated, "activated", false, "Create the user already activated")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if plaintextPassword == "" {
+		plaintextPassword, err = app.readPassword()
+		if err != nil {
+			return err
+		}
+	}
+
+	user := &data.User{
+		Name:      name,
+		Email:     email,
+		Activated: activated,
+	}
+
+	err = user.Password.Set(plaintextPassword)
+	if err != nil {
+		return err
+	}
+
+	v := validator.New()
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		return &validationError{errors: v.Errors}
+	}
+
+	var roleNames data.Roles
+	for _, role := range strings.Split(roles, ",") {
+		roleNames = append(roleNames, strings.TrimSpace(role))
+	}
+
+	err = app.checkRolesExist(ctx, v, roleNames)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Transaction(ctx, func(tx data.Models) error {
+		err := tx.Users.Insert(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		return tx.Roles.AddForUser(ctx, user.ID, roleNames...)
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateEmail) {
+			v.AddError("email", "a user with this email address already exists")
+			return &validationError{errors: v.Errors}
+		}
+
+		return err
+	}
+
+	return app.writeJSON(envelope{"user": user, "roles": roleNames})
+}
+
+func (app *application) activateUser(ctx context.Context, args []string) error {
+	return app.setActivated(ctx, args, true)
+}
+
+// Deactivating a user also ends all of their sessions.
+func (app *application) deactivateUser(ctx context.Context, args []string) error {
+	return app.setActivated(ctx, args, false)
+}
+
+func (app *application) setActivated(ctx context.Context, args []string, activated bool) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one email address")
+	}
+
+	var user *data.User
+
+	err := app.models.Transaction(ctx, func(tx data.Models) error {
+		var err error
+
+		user, err = app.getUser(ctx, tx, args[0])
+		if err != nil {
+			return err
+		}
+
+		if !activated {
+			for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+				err = tx.Tokens.DeleteAllForUser(ctx, scope, user.ID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if user.Activated == activated {
+			return nil
+		}
+
+		user.Activated = activated
+
+		return tx.Users.Update(ctx, user)
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.writeJSON(envelope{"user": user})
+}
+
+func (app *application) listUsers(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errors.New("user list takes no arguments")
+	}
+
+	users, err := app.models.Users.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	return app.writeJSON(envelope{"users": users})
+}
+
+// Helper to look up a user by email address with a readable error if they don't exist.
+func (app *application) getUser(ctx context.Context, models data.Models, email string) (*data.User, error) {
+	user, err := models.Users.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, fmt.Errorf("no user with email address %q", email)
+		}
+
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Checks that every role exists, since assigning an unknown role is silently ignored by the model.
+func (app *application) checkRolesExist(ctx context.Context, v *validator.Validator, names data.Roles) error {
+	roles, err := app.models.Roles.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing := make(data.Roles, len(roles))
+	for i, role := range roles {
+		existing[i] = role.Name
+	}
+
+	for _, name := range names {
+		v.Check(existing.Include(name), "roles", fmt.Sprintf("%q does not exist", name))
+	}
+
+	if !v.Valid() {
+		return &validationError{errors: v.Errors}
+	}
+
+	return nil
+}
+
+// Reads the password from the first line of stdin.
+func (app *application) readPassword() (string, error) {
+	scanner := bufio.NewScanner(app.stdin)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", err
+		}
+
+		return "", errors.New("no password provided on stdin")
+	}
+
+	return strings.TrimRight(scanner.Text(), "\r"), nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ricci2511/greenlight-api/internal/jsonlog"
+	"github.com/ricci2511/greenlight-api/internal/validator"
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of the environment variables that configure the application, e.g. GREENLIGHT_DB_DSN for -db-dsn.
+const envPrefix = "GREENLIGHT_"
+
+// Flags that control how the configuration is loaded, which can't be set in the config file or env.
+var loaderFlags = map[string]bool{
+	"config":       true,
+	"print-config": true,
+	"version":      true,
+}
+
+// Flags whose values are redacted by -print-config.
+var secretFlags = map[string]bool{
+	"db-dsn":        true,
+	"smtp-password": true,
+}
+
+// Result of loading the configuration from all its sources.
+type loadedConfig struct {
+	cfg            config
+	file           string
+	printConfig    bool
+	displayVersion bool
+	fs             *flag.FlagSet
+}
+
+// Registers every config setting as a flag on a new FlagSet, the flag names double as
+// config file keys and env variable names.
+func newFlagSet(cfg *config, lc *loadedConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+	// Config loading.
+	fs.StringVar(&lc.file, "config", "", "Path to a YAML config file (env GREENLIGHT_CONFIG)")
+	fs.BoolVar(&lc.printConfig, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+	fs.BoolVar(&lc.displayVersion, "version", false, "Display version and exit")
+
+	// Server settings.
+	fs.IntVar(&cfg.port, "port", 4000, "API server port")
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	fs.DurationVar(&cfg.shutdown.drainPeriod, "shutdown-drain-period", 5*time.Second, "Time between failing the readiness check and shutting down the server")
+
+	// Logging settings.
+	fs.Var((*levelValue)(&cfg.log.level), "log-level", "Minimum log level (debug|info|warn|error)")
+	fs.BoolVar(&cfg.log.trace, "log-trace", false, "Include stack traces in error log entries")
+
+	// Database settings.
+	fs.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("DATABASE_DSN"), "PostgreSQL DSN")
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
+	fs.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time (duration)")
+	fs.DurationVar(&cfg.db.queryTimeout, "db-query-timeout", 3*time.Second, "Timeout of a single PostgreSQL query, applied on top of the request context")
+	fs.BoolVar(&cfg.db.autoMigrate, "auto-migrate", false, "Apply pending database migrations on startup instead of refusing to start")
+
+	// Rate limiter settings.
+	fs.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	fs.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	fs.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+
+	// SMTP settings.
+	fs.StringVar(&cfg.smtp.transport, "smtp-transport", "smtp", "Mail transport (smtp|file|memory)")
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP server hostname")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 2525, "SMTP server port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@github.com/ricci2511/greenlight-api>", "SMTP sender")
+	fs.StringVar(&cfg.smtp.outboxDir, "smtp-outbox-dir", "./tmp/outbox", "Directory the file mail transport writes .eml files to")
+
+	// Email outbox settings.
+	fs.DurationVar(&cfg.outbox.pollInterval, "outbox-poll-interval", 5*time.Second, "Interval at which the email outbox is checked for due emails")
+	fs.IntVar(&cfg.outbox.batchSize, "outbox-batch-size", 10, "Maximum number of emails claimed from the outbox at once")
+	fs.IntVar(&cfg.outbox.maxAttempts, "outbox-max-attempts", 8, "Delivery attempts before an email is dead-lettered")
+	fs.DurationVar(&cfg.outbox.sentRetention, "outbox-sent-retention", 7*24*time.Hour, "Time delivered emails are kept before they are purged")
+	fs.DurationVar(&cfg.outbox.deadRetention, "outbox-dead-retention", 30*24*time.Hour, "Time dead-lettered emails are kept before they are purged")
+
+	// Movie trash settings.
+	fs.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "Time deleted movies are kept in the trash before they are purged")
+	fs.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "Interval at which expired movies are purged from the trash")
+
+	// Access log settings.
+	fs.BoolVar(&cfg.accessLog.enabled, "access-log-enabled", true, "Log every request to the access log")
+	fs.Float64Var(&cfg.accessLog.sampleRate, "access-log-sample-rate", 1, "Ratio of successful requests written to the access log (0-1)")
+
+	// Tracing settings.
+	fs.StringVar(&cfg.otel.exporter, "otel-exporter", "none", "OpenTelemetry span exporter (none|stdout|otlp)")
+	fs.StringVar(&cfg.otel.endpoint, "otel-endpoint", "localhost:4318", "OTLP/HTTP collector endpoint (host:port)")
+	fs.BoolVar(&cfg.otel.insecure, "otel-insecure", false, "Use plain HTTP instead of HTTPS for the OTLP exporter")
+	fs.Float64Var(&cfg.otel.sampleRatio, "otel-sample-ratio", 1, "Ratio of traces to sample when the client didn't decide")
+
+	// CORS settings.
+	fs.Var((*fieldsValue)(&cfg.cors.trustedOrigins), "cors-trusted-origins", "Trusted CORS origins (space separated)")
+
+	return fs
+}
+
+// Loads the configuration with the precedence flags > env > config file > defaults, and validates it.
+func loadConfig(args []string) (*loadedConfig, error) {
+	lc := &loadedConfig{}
+	fs := newFlagSet(&lc.cfg, lc)
+	lc.fs = fs
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flags explicitly passed on the command line are never overridden.
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if lc.file == "" {
+		lc.file = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	if lc.file != "" {
+		values, err := readConfigFile(lc.file)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, value := range values {
+			if loaderFlags[name] || fs.Lookup(name) == nil {
+				return nil, fmt.Errorf("config file %s: unknown setting %q", lc.file, name)
+			}
+
+			if explicit[name] {
+				continue
+			}
+
+			err := fs.Set(name, value)
+			if err != nil {
+				return nil, fmt.Errorf("config file %s: invalid value for %s: %w", lc.file, name, err)
+			}
+		}
+	}
+
+	var envErr error
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if envErr != nil || loaderFlags[f.Name] || explicit[f.Name] {
+			return
+		}
+
+		key := envName(f.Name)
+
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			return
+		}
+
+		err := fs.Set(f.Name, value)
+		if err != nil {
+			envErr = fmt.Errorf("env %s: %w", key, err)
+		}
+	})
+
+	if envErr != nil {
+		return nil, envErr
+	}
+
+	return lc, nil
+}
+
+// Reads a YAML config file, flattening nested keys into flag names, e.g. db.max-open-conns
+// becomes db-max-open-conns.
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+
+	err = yaml.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flattenConfig(values, "", raw)
+
+	return values, nil
+}
+
+func flattenConfig(values map[string]string, prefix string, raw map[string]any) {
+	for key, value := range raw {
+		if prefix != "" {
+			key = prefix + "-" + key
+		}
+
+		switch value := value.(type) {
+		case map[string]any:
+			flattenConfig(values, key, value)
+		case []any:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, " ")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// Returns the env variable name for a flag, e.g. GREENLIGHT_DB_DSN for db-dsn.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func validateConfig(v *validator.Validator, cfg config) {
+	v.Check(cfg.port > 0 && cfg.port <= 65535, "port", "must be between 1 and 65535")
+	v.Check(validator.PermittedValue(cfg.env, "development", "staging", "production"), "env", "must be development, staging or production")
+	v.Check(cfg.shutdown.drainPeriod >= 0, "shutdown-drain-period", "must not be negative")
+
+	v.Check(cfg.db.dsn != "", "db-dsn", "must be provided")
+	v.Check(cfg.db.maxOpenConns > 0, "db-max-open-conns", "must be greater than zero")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "must not be negative")
+
+	v.Check(cfg.db.queryTimeout > 0, "db-query-timeout", "must be greater than zero")
+
+	_, err := time.ParseDuration(cfg.db.maxIdleTime)
+	v.Check(err == nil, "db-max-idle-time", "must be a valid duration")
+
+	validateLimiter(v, cfg)
+
+	v.Check(validator.PermittedValue(cfg.smtp.transport, "smtp", "file", "memory"), "smtp-transport", "must be smtp, file or memory")
+	if cfg.smtp.transport == "smtp" {
+		v.Check(cfg.smtp.host != "", "smtp-host", "must be provided")
+		v.Check(cfg.smtp.port > 0 && cfg.smtp.port <= 65535, "smtp-port", "must be between 1 and 65535")
+	}
+	if cfg.smtp.transport == "file" {
+		v.Check(cfg.smtp.outboxDir != "", "smtp-outbox-dir", "must be provided")
+	}
+	v.Check(cfg.smtp.sender != "", "smtp-sender", "must be provided")
+
+	v.Check(cfg.outbox.pollInterval > 0, "outbox-poll-interval", "must be greater than zero")
+	v.Check(cfg.outbox.batchSize > 0, "outbox-batch-size", "must be greater than zero")
+	v.Check(cfg.outbox.maxAttempts > 0, "outbox-max-attempts", "must be greater than zero")
+	v.Check(cfg.outbox.sentRetention > 0, "outbox-sent-retention", "must be greater than zero")
+	v.Check(cfg.outbox.deadRetention > 0, "outbox-dead-retention", "must be greater than zero")
+
+	v.Check(cfg.trash.retention > 0, "trash-retention", "must be greater than zero")
+	v.Check(cfg.trash.purgeInterval > 0, "trash-purge-interval", "must be greater than zero")
+
+	v.Check(cfg.accessLog.sampleRate >= 0 && cfg.accessLog.sampleRate <= 1, "access-log-sample-rate", "must be between 0 and 1")
+
+	v.Check(validator.PermittedValue(cfg.otel.exporter, "none", "stdout", "otlp"), "otel-exporter", "must be none, stdout or otlp")
+	v.Check(cfg.otel.sampleRatio >= 0 && cfg.otel.sampleRatio <= 1, "otel-sample-ratio", "must be between 0 and 1")
+}
+
+func validateLimiter(v *validator.Validator, cfg config) {
+	if !cfg.limiter.enabled {
+		return
+	}
+
+	v.Check(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+	v.Check(cfg.limiter.burst > 0, "limiter-burst", "must be greater than zero")
+}
+
+// Writes the effective configuration as a YAML config file, with secrets redacted.
+func (lc *loadedConfig) print(w io.Writer) error {
+	values := make(map[string]string)
+
+	lc.fs.VisitAll(func(f *flag.Flag) {
+		if loaderFlags[f.Name] {
+			return
+		}
+
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = redact(value)
+		}
+
+		values[f.Name] = value
+	})
+
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// Redacts a secret, keeping everything but the password of URLs such as the DSN.
+func redact(secret string) string {
+	u, err := url.Parse(secret)
+	if err == nil && u.User != nil {
+		return u.Redacted()
+	}
+
+	return "xxxxx"
+}
+
+// flag.Value for a log level.
+type levelValue slog.Level
+
+func (l *levelValue) String() string {
+	return strings.ToLower(slog.Level(*l).String())
+}
+
+func (l *levelValue) Set(s string) error {
+	level, err := jsonlog.ParseLevel(s)
+	if err != nil {
+		return errors.New("must be debug, info, warn, error, fatal or off")
+	}
+
+	*l = levelValue(level)
+	return nil
+}
+
+// flag.Value for a space separated list of strings.
+type fieldsValue []string
+
+func (f *fieldsValue) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *fieldsValue) Set(s string) error {
+	*f = strings.Fields(s)
+	return nil
+}
@@ -5,13 +5,28 @@ import (
 	"net/http"
 
 	"github.com/ricci2511/greenlight-api/internal/data"
+	"github.com/ricci2511/greenlight-api/internal/jsonlog"
 )
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey       = contextKey("user")
+	requestLogContextKey = contextKey("requestLog")
+)
+
+// Holds request details that are only known further down the middleware chain,
+// but are needed by the accessLog middleware once the response has been written.
+type requestLog struct {
+	userID int64
+}
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	// Let the access log know which user made the request.
+	if rl, ok := r.Context().Value(requestLogContextKey).(*requestLog); ok {
+		rl.userID = user.ID
+	}
+
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -27,3 +42,15 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	// Stored by jsonlog, so that it is added to every log entry written with the request context.
+	ctx := jsonlog.ContextWithRequestID(r.Context(), requestID)
+	return r.WithContext(ctx)
+}
+
+// Unlike the user, the request ID is optional, e.g. for responses sent before the requestID middleware
+// runs. In that case an empty string is returned.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	return jsonlog.RequestIDFromContext(r.Context())
+}
@@ -1,27 +1,110 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintError(err, map[string]string{
-		"requestMethod": r.Method,
-		"requestURL":    r.URL.String(),
-	})
+	app.logger.ErrorContext(r.Context(), err.Error(),
+		slog.String("requestMethod", r.Method),
+		slog.String("requestURL", r.URL.String()),
+	)
 }
 
 // Helper to send JSON-formatted error messages to the client.
+//
+// Clients that accept application/problem+json get an RFC 7807 problem details object,
+// everyone else gets the message wrapped in an {"error": ...} envelope.
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
-	err := app.writeJSON(w, status, envelope{"error": message}, nil)
+	// The shape of error responses depends on the Accept header.
+	w.Header().Add("Vary", "Accept")
+
+	var err error
+
+	if app.acceptsProblemJSON(r) {
+		err = app.writeProblem(w, r, status, message)
+	} else {
+		// The request ID lets clients reference the matching log entries when reporting a problem.
+		err = app.writeJSON(w, status, envelope{"error": message, "requestId": app.contextGetRequestID(r)}, nil)
+	}
+
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// Helper to send an RFC 7807 problem details object to the client.
+// https://www.rfc-editor.org/rfc/rfc7807
+//
+// Validation errors are included in the "errors" extension member.
+func (app *application) writeProblem(w http.ResponseWriter, r *http.Request, status int, message any) error {
+	problem := envelope{
+		"type":     "about:blank",
+		"title":    http.StatusText(status),
+		"status":   status,
+		"instance": r.URL.Path,
+		// Extension member, see errorResponse().
+		"requestId": app.contextGetRequestID(r),
+	}
+
+	switch msg := message.(type) {
+	case map[string]string:
+		problem["detail"] = "the request contains one or more invalid fields"
+		problem["errors"] = msg
+	default:
+		problem["detail"] = msg
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", "application/problem+json")
+
+	return app.writeJSON(w, status, problem, headers)
+}
+
+// Checks if the client explicitly accepts application/problem+json responses through the Accept header.
+func (app *application) acceptsProblemJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil || mediaType != "application/problem+json" {
+			continue
+		}
+
+		// A quality value of 0 means the media type is not acceptable.
+		if q, ok := params["q"]; ok {
+			if weight, err := strconv.ParseFloat(q, 64); err != nil || weight <= 0 {
+				continue
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// Non-standard status recorded when the client went away before the response was written, as used by nginx.
+const statusClientClosedRequest = 499
+
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	// Queries are cancelled together with the request context when the client disconnects,
+	// which is expected and not worth an error log entry. Nobody is left to read a response body.
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		app.logger.InfoContext(r.Context(), "request cancelled by client",
+			slog.String("requestMethod", r.Method),
+			slog.String("requestURL", r.URL.String()),
+		)
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+
 	// log any server errors.
 	app.logError(r, err)
 
@@ -52,6 +135,11 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since it was last retrieved, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
@@ -70,6 +158,11 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid, expired or revoked refresh token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
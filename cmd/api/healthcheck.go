@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// Time the result of the mail transport check is reused for, so that frequent readiness probes
+// don't open a new SMTP connection every time.
+const mailCheckTTL = time.Minute
+
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 	data := envelope{
 		"status": "available",
@@ -18,3 +26,80 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// Reports whether the process is up and able to serve requests at all.
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Reports whether the server should receive traffic, which requires the database to be reachable
+// and no shutdown to be in progress.
+//
+// The mail check is informational only, emails wait in the outbox while the mail server is unavailable.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	checks := map[string]string{
+		"database": app.dependencyStatus(r, "database", app.models.Ping(ctx)),
+		"mail":     app.dependencyStatus(r, "mail", app.mailCheck.run(ctx, mailCheckTTL, app.mailer.Check)),
+	}
+
+	ready := checks["database"] == "ok"
+
+	if app.shuttingDown.Load() {
+		checks["server"] = "shutting down"
+		ready = false
+	}
+
+	status, code := "available", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	err := app.writeJSON(w, code, envelope{"status": status, "checks": checks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Helper to log a failed dependency check, returning the status reported for it.
+func (app *application) dependencyStatus(r *http.Request, name string, err error) string {
+	if err == nil {
+		return "ok"
+	}
+
+	app.logger.WarnContext(r.Context(), "readiness check failed",
+		slog.String("dependency", name),
+		slog.String("error", err.Error()),
+	)
+
+	return "unavailable"
+}
+
+// Dependency check whose result is cached for a while.
+type cachedCheck struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// Returns the cached result if it is younger than the ttl, otherwise runs the check and caches its result.
+//
+// Concurrent callers wait for a running check instead of starting one of their own.
+func (c *cachedCheck) run(ctx context.Context, ttl time.Duration, check func(ctx context.Context) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < ttl {
+		return c.err
+	}
+
+	c.err = check(ctx)
+	c.checkedAt = time.Now()
+
+	return c.err
+}
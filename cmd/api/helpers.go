@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -24,6 +25,50 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// Helper to retrieve the version parameter from the request URL.
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+
+	return int32(version), nil
+}
+
+// Helper to build a strong entity tag from the version of a record.
+func (app *application) etag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// Helper to check if an entity tag matches any of the tags listed in an If-Match or If-None-Match header.
+//
+// If-None-Match uses the weak comparison function, meaning that the W/ prefix is ignored, while
+// If-Match requires a strong comparison where weak tags never match.
+// https://www.rfc-editor.org/rfc/rfc9110#section-8.8.3.2
+func (app *application) etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "*" {
+			return true
+		}
+
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+
+		if tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
 // JSON envelope type.
 type envelope map[string]any
 
@@ -40,11 +85,13 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	// Makes it look prettier in the terminal.
 	js = append(js, '\n')
 
+	// Set before the additional headers so that they can override the content type.
+	w.Header().Set("Content-Type", "application/json")
+
 	for key, val := range headers {
 		w.Header()[key] = val
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	w.Write(js)
 
@@ -163,6 +210,51 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// Helper to read a specific boolean parameter from a url query string.
+// A validator instance is passed to add a validation error if the parameter is an invalid boolean.
+//
+// Returns the provided default value if the parameter is not found or invalid.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// Helper to retrieve the token from an Authorization header in the "Bearer <token>" format.
+//
+// Returns an empty string if the header is missing or malformed.
+func (app *application) readBearerToken(r *http.Request) string {
+	headerParts := strings.Split(r.Header.Get("Authorization"), " ")
+
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return ""
+	}
+
+	return headerParts[1]
+}
+
+// Helper to retrieve the client's IP address without the port.
+//
+// The middleware.RealIP middleware replaces the remote address with the X-Forwarded-For address when present.
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
 // Helper to run a function in a background goroutine.
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
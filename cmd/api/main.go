@@ -3,19 +3,23 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"runtime"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/ricci2511/greenlight-api/internal/data"
 	"github.com/ricci2511/greenlight-api/internal/jsonlog"
 	"github.com/ricci2511/greenlight-api/internal/mailer"
+	"github.com/ricci2511/greenlight-api/internal/validator"
 )
 
 // Hardcoded for now,
@@ -23,13 +27,22 @@ const version = "1.0.0"
 
 // Holds app config settings.
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port     int
+	env      string
+	shutdown struct {
+		drainPeriod time.Duration
+	}
+	log struct {
+		level slog.Level
+		trace bool
+	}
+	db struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		queryTimeout time.Duration
+		autoMigrate  bool
 	}
 	limiter struct {
 		rps     float64
@@ -37,30 +50,76 @@ type config struct {
 		enabled bool
 	}
 	smtp struct {
-		host     string
-		port     int
-		username string
-		password string
-		sender   string
+		transport string
+		host      string
+		port      int
+		username  string
+		password  string
+		sender    string
+		outboxDir string
 	}
 	cors struct {
 		trustedOrigins []string
 	}
+	outbox struct {
+		pollInterval  time.Duration
+		batchSize     int
+		maxAttempts   int
+		sentRetention time.Duration
+		deadRetention time.Duration
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	accessLog struct {
+		enabled    bool
+		sampleRate float64
+	}
+	otel struct {
+		exporter    string
+		endpoint    string
+		insecure    bool
+		sampleRatio float64
+	}
 }
 
 // Holds application-wide dependencies.
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config          config
+	logger          *jsonlog.Logger
+	logLevel        *slog.LevelVar
+	models          data.Models
+	mailer          mailer.Mailer
+	metricsRegistry *prometheus.Registry
+	wg              sync.WaitGroup
+
+	// Copy of config whose rate limiter, CORS and log level settings are swapped on SIGHUP.
+	runtimeConfig atomic.Pointer[config]
+
+	// Set once a shutdown signal has been received, makes the readiness check fail.
+	shuttingDown atomic.Bool
+
+	// Last result of the mail transport check, reused by readiness checks until it expires.
+	mailCheck cachedCheck
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg := parseFlags()
 
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(cfg.log.level)
+
+	logger := jsonlog.New(os.Stdout, &jsonlog.HandlerOptions{Level: logLevel, Trace: cfg.log.trace})
 
 	db, err := openDb(cfg)
 	if err != nil {
@@ -70,64 +129,85 @@ func main() {
 	defer db.Close()
 	logger.PrintInfo("database connection pool established", nil)
 
-	// Set basic application metrics.
-	setExpVars(db)
+	err = checkSchema(db, cfg.db.autoMigrate, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	shutdownTracing, err := setupTracing(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	transport, err := newMailTransport(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:          cfg,
+		logger:          logger,
+		logLevel:        logLevel,
+		models:          data.NewModels(db, cfg.db.queryTimeout),
+		mailer:          mailer.New(transport, cfg.smtp.sender),
+		metricsRegistry: newMetricsRegistry(db),
 	}
 
+	app.runtimeConfig.Store(&cfg)
+
+	// Set basic application metrics.
+	setExpVars(app.models)
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
+
+	// Flush the spans of the last requests before exiting.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = shutdownTracing(ctx)
+	if err != nil {
+		logger.PrintError(err, nil)
+	}
 }
 
+// Loads the config from flags, env and config file, exiting on invalid config or when only
+// the version or the effective config should be displayed.
 func parseFlags() config {
-	var cfg config
-
-	// Server settings.
-	flag.IntVar(&cfg.port, "port", 4000, "API server port")
-	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
-
-	// Database settings.
-	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("DATABASE_DSN"), "PostgreSQL DSN")
-	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
-	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
-	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time (duration)")
-
-	// Rate limiter settings.
-	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
-	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
-	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
-
-	// SMTP settings.
-	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP server hostname")
-	flag.IntVar(&cfg.smtp.port, "smtp-port", 2525, "SMTP server port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
-	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@github.com/ricci2511/greenlight-api>", "SMTP sender")
-
-	// CORS settings.
-	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
-		cfg.cors.trustedOrigins = strings.Fields(val)
-		return nil
-	})
-
-	// Version display.
-	displayVersion := flag.Bool("version", false, "Display version and exit")
-
-	flag.Parse()
-
-	if *displayVersion {
+	lc, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if lc.displayVersion {
 		fmt.Printf("Version: %s\n", version)
 		os.Exit(0)
 	}
 
-	return cfg
+	if lc.printConfig {
+		err = lc.print(os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	v := validator.New()
+	if validateConfig(v, lc.cfg); !v.Valid() {
+		for key, message := range v.Errors {
+			fmt.Fprintf(os.Stderr, "invalid config: %s %s\n", key, message)
+		}
+		os.Exit(2)
+	}
+
+	return lc.cfg
 }
 
 func openDb(cfg config) (*sql.DB, error) {
@@ -160,7 +240,21 @@ func openDb(cfg config) (*sql.DB, error) {
 	return db, nil
 }
 
-func setExpVars(db *sql.DB) {
+// Returns the mail transport selected with the -smtp-transport flag.
+func newMailTransport(cfg config) (mailer.Transport, error) {
+	switch cfg.smtp.transport {
+	case "smtp":
+		return mailer.NewSMTPTransport(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password), nil
+	case "file":
+		return mailer.NewFileTransport(cfg.smtp.outboxDir)
+	case "memory":
+		return mailer.NewMemoryTransport(), nil
+	default:
+		return nil, fmt.Errorf("invalid mail transport %q", cfg.smtp.transport)
+	}
+}
+
+func setExpVars(models data.Models) {
 	expvar.NewString("version").Set(version)
 
 	// Number of active goroutines.
@@ -168,9 +262,14 @@ func setExpVars(db *sql.DB) {
 		return runtime.NumGoroutine()
 	}))
 
-	// Database connection pool statistics.
-	expvar.Publish("database", expvar.Func(func() any {
-		return db.Stats()
+	// Number of outbox emails by delivery status.
+	expvar.Publish("outbox", expvar.Func(func() any {
+		counts, err := models.Outbox.CountByStatus(context.Background())
+		if err != nil {
+			return nil
+		}
+
+		return counts
 	}))
 
 	// Current Unix timestamp.
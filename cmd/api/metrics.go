@@ -0,0 +1,24 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Returns a Prometheus registry with the Go runtime, process and database connection pool metrics.
+//
+// HTTP metrics are registered by the metrics() middleware.
+func newMetricsRegistry(db *sql.DB) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		// Exposes the same statistics as db.Stats(), e.g. open, in use and idle connections.
+		collectors.NewDBStatsCollector(db, "greenlight"),
+	)
+
+	return registry
+}
@@ -1,21 +1,61 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"expvar"
 	"fmt"
-	"net"
+	"log/slog"
+	mathrand "math/rand"
 	"net/http"
+	"regexp"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 	"github.com/ricci2511/greenlight-api/internal/data"
 	"github.com/ricci2511/greenlight-api/internal/validator"
 )
 
+// Request IDs sent by clients or proxies are only accepted if they look sane, so they are safe to log.
+var requestIDRX = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,128}$`)
+
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Reuse the request ID of an upstream proxy or client, otherwise generate a new one.
+		requestID := r.Header.Get("X-Request-ID")
+
+		if !requestIDRX.MatchString(requestID) {
+			randomBytes := make([]byte, 16)
+
+			_, err := rand.Read(randomBytes)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			requestID = hex.EncodeToString(randomBytes)
+		}
+
+		// Return the request ID to the client, so it can be referenced when reporting problems.
+		w.Header().Set("X-Request-ID", requestID)
+
+		r = app.contextSetRequestID(r, requestID)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -60,18 +100,25 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 	}()
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.limiter.enabled {
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
-			if err != nil {
-				app.serverErrorResponse(w, r, err)
-				return
-			}
+		limiterCfg := app.runtimeConfig.Load().limiter
+
+		if limiterCfg.enabled {
+			// RealIP runs before this middleware, so RemoteAddr may be a bare IP without a port.
+			ip := app.clientIP(r)
 
 			mu.Lock()
 
 			// Init a new rate limiter for every new IP address.
 			if _, exists := clients[ip]; !exists {
-				clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
+				clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(limiterCfg.rps), limiterCfg.burst)}
+			}
+
+			// Apply limits changed by a config reload to existing clients.
+			if clients[ip].limiter.Limit() != rate.Limit(limiterCfg.rps) {
+				clients[ip].limiter.SetLimit(rate.Limit(limiterCfg.rps))
+			}
+			if clients[ip].limiter.Burst() != limiterCfg.burst {
+				clients[ip].limiter.SetBurst(limiterCfg.burst)
 			}
 
 			// Update last seen time for the client.
@@ -104,15 +151,13 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		// The expected format of the authorizationHeader is "Bearer <token>"
-		headerParts := strings.Split(authorizationHeader, " ")
+		token := app.readBearerToken(r)
 
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		if token == "" {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
-		token := headerParts[1]
-
 		v := validator.New()
 
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
@@ -120,7 +165,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
 		if err != nil {
 			if errors.Is(err, data.ErrRecordNotFound) {
 				app.invalidAuthenticationTokenResponse(w, r)
@@ -131,6 +176,13 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Keep track of when the session was last active.
+		err = app.models.Tokens.Touch(r.Context(), token)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
 		// On successful authentication, add the user information to the request context.
 		r = app.contextSetUser(r, user)
 
@@ -172,7 +224,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -199,16 +251,18 @@ func (app *application) enableCors(next http.Handler) http.Handler {
 
 		// Check if the origin header is set and is trusted for CORS.
 		if origin != "" {
-			for _, trustedOrigin := range app.config.cors.trustedOrigins {
+			for _, trustedOrigin := range app.runtimeConfig.Load().cors.trustedOrigins {
 				if origin == trustedOrigin {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					// Allow cross-origin clients to read the ETag for conditional requests and the request ID.
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
 
 					// If it passes these checks, treat it as a preflight request.
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						// Set necessary headers for preflight requests.
 						// https://developer.mozilla.org/en-US/docs/Glossary/Preflight_request
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, X-Request-ID")
 
 						w.WriteHeader(http.StatusOK)
 						return
@@ -223,10 +277,11 @@ func (app *application) enableCors(next http.Handler) http.Handler {
 	})
 }
 
-// Custom wrapper around http.ResponseWriter to capture the status code of responses.
+// Custom wrapper around http.ResponseWriter to capture the status code and size of responses.
 type metricsResponseWriter struct {
 	wrapped       http.ResponseWriter
 	statusCode    int
+	bytesWritten  int
 	headerWritten bool
 }
 
@@ -249,7 +304,11 @@ func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
 
 func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
 	mw.headerWritten = true
-	return mw.wrapped.Write(b)
+
+	n, err := mw.wrapped.Write(b)
+	mw.bytesWritten += n
+
+	return n, err
 }
 
 func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
@@ -258,28 +317,115 @@ func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
 
 func (app *application) metrics(next http.Handler) http.Handler {
 	var (
-		totalRequestsReceived      = expvar.NewInt("total_requests_received")
-		totalResponsesSent         = expvar.NewInt("total_responses_sent")
-		totalProcessingTime        = expvar.NewInt("total_processing_time_μs") // In microseconds
-		totalResponsesSentByStatus = expvar.NewMap("total_responses_sent_by_status")
+		requestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "greenlight",
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests currently being served.",
+		})
+		requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "greenlight",
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route pattern, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"})
 	)
 
+	app.metricsRegistry.MustRegister(requestsInFlight, requestDuration)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		totalRequestsReceived.Add(1)
+		requestsInFlight.Inc()
+		defer requestsInFlight.Dec()
 
 		mw := newMetricsResponseWriter(w)
 
 		// Pass the metricsResponseWriter to the next handler in the chain.
 		next.ServeHTTP(mw, r)
 
-		totalResponsesSent.Add(1)
+		// The route pattern is only known once the router has matched the request. Requests that didn't
+		// match any route share a single label value, to keep arbitrary paths from exploding the cardinality.
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(mw.statusCode)).Observe(time.Since(start).Seconds())
+	})
+}
+
+func (app *application) trace(next http.Handler) http.Handler {
+	tracer := otel.Tracer("github.com/ricci2511/greenlight-api/cmd/api")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Continue the trace of the client if the request contains a traceparent header.
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracer.Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPTarget(r.URL.RequestURI()),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				attribute.String("http.request_id", app.contextGetRequestID(r)),
+			),
+		)
+		defer span.End()
+
+		mw := newMetricsResponseWriter(w)
+
+		next.ServeHTTP(mw, r.WithContext(ctx))
+
+		// The span is named after the route pattern once the router has matched the request,
+		// so that all requests to the same route are grouped together.
+		if route := chi.RouteContext(r.Context()).RoutePattern(); route != "" {
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+
+		span.SetAttributes(semconv.HTTPStatusCode(mw.statusCode))
+
+		if mw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(mw.statusCode))
+		}
+	})
+}
 
-		// Record the response status code count.
-		totalResponsesSentByStatus.Add(strconv.Itoa(mw.statusCode), 1)
+func (app *application) accessLog(next http.Handler) http.Handler {
+	if !app.config.accessLog.enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Filled in by contextSetUser() once the authenticate middleware has identified the user.
+		rl := &requestLog{}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogContextKey, rl))
+
+		mw := newMetricsResponseWriter(w)
+
+		next.ServeHTTP(mw, r)
+
+		// Only a sample of successful requests is logged, errors are always logged.
+		if mw.statusCode < http.StatusBadRequest && mathrand.Float64() >= app.config.accessLog.sampleRate {
+			return
+		}
+
+		attrs := []any{
+			slog.String("method", r.Method),
+			slog.String("route", chi.RouteContext(r.Context()).RoutePattern()),
+			slog.String("url", r.URL.String()),
+			slog.Int("status", mw.statusCode),
+			slog.Int("bytes", mw.bytesWritten),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("ip", app.clientIP(r)),
+		}
+
+		if rl.userID != 0 {
+			attrs = append(attrs, slog.Int64("userID", rl.userID))
+		}
 
-		duration := time.Since(start).Microseconds()
-		totalProcessingTime.Add(duration)
+		app.logger.InfoContext(r.Context(), "request completed", attrs...)
 	})
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitBehindProxy(t *testing.T) {
+	app := newTestApplication(t)
+
+	cfg := app.config
+	cfg.limiter.enabled = true
+	cfg.limiter.burst = 2
+	app.runtimeConfig.Store(&cfg)
+
+	routes := app.routes()
+
+	tests := []struct {
+		name         string
+		forwardedFor string
+		wantStatus   int
+	}{
+		{name: "first request", forwardedFor: "203.0.113.7", wantStatus: http.StatusOK},
+		{name: "second request", forwardedFor: "203.0.113.7", wantStatus: http.StatusOK},
+		{name: "over the burst", forwardedFor: "203.0.113.7", wantStatus: http.StatusTooManyRequests},
+		{name: "other client behind the same proxy", forwardedFor: "203.0.113.8", wantStatus: http.StatusOK},
+	}
+
+	// The cases run in order against the same limiter, all from the proxy's address.
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/healthz/live", nil)
+		r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: got status %d; want %d, body: %s", tt.name, w.Code, tt.wantStatus, w.Body)
+		}
+	}
+}
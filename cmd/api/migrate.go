@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/ricci2511/greenlight-api/internal/jsonlog"
+	"github.com/ricci2511/greenlight-api/migrations"
+)
+
+const migrateUsage = "usage: api migrate [flags] up [N] | down [N|all] | status | force VERSION"
+
+// Runs the migrations embedded in the binary against the database.
+type migrator struct {
+	*migrate.Migrate
+	source source.Driver
+}
+
+// Returns a migrator using a single connection of the pool, which is released again by Close.
+func newMigrator(db *sql.DB) (*migrator, error) {
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		driver.Close()
+		return nil, err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		src.Close()
+		driver.Close()
+		return nil, err
+	}
+
+	return &migrator{Migrate: m, source: src}, nil
+}
+
+// Returns the version of the latest embedded migration.
+func (m *migrator) latestVersion() (uint, error) {
+	version, err := m.source.First()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		next, err := m.source.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		version = next
+	}
+}
+
+// Returns the version the database schema is at, which is 0 if no migration has been applied yet.
+func (m *migrator) currentVersion() (uint, bool, error) {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+
+	return version, dirty, err
+}
+
+// Entry point of the migrate subcommand, which accepts the same flags, env and config file as the server.
+func runMigrate(args []string) error {
+	lc, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+
+	cmdArgs := lc.fs.Args()
+	if len(cmdArgs) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if lc.cfg.db.dsn == "" {
+		return errors.New("db-dsn must be provided")
+	}
+
+	db, err := openDb(lc.cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch cmdArgs[0] {
+	case "up":
+		if len(cmdArgs) == 1 {
+			err = m.Up()
+			break
+		}
+
+		n, ok := parseSteps(cmdArgs[1])
+		if !ok {
+			return errors.New(migrateUsage)
+		}
+		err = m.Steps(n)
+	case "down":
+		if len(cmdArgs) > 1 && cmdArgs[1] == "all" {
+			err = m.Down()
+			break
+		}
+
+		n := 1
+		if len(cmdArgs) > 1 {
+			var ok bool
+			if n, ok = parseSteps(cmdArgs[1]); !ok {
+				return errors.New(migrateUsage)
+			}
+		}
+		err = m.Steps(-n)
+	case "force":
+		if len(cmdArgs) != 2 {
+			return errors.New(migrateUsage)
+		}
+
+		version, convErr := strconv.Atoi(cmdArgs[1])
+		if convErr != nil {
+			return errors.New(migrateUsage)
+		}
+		err = m.Force(version)
+	case "status":
+		return printMigrationStatus(m)
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("no change")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return printMigrationStatus(m)
+}
+
+// Helper to parse a positive number of migration steps.
+func parseSteps(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n > 0
+}
+
+func printMigrationStatus(m *migrator) error {
+	current, dirty, err := m.currentVersion()
+	if err != nil {
+		return err
+	}
+
+	latest, err := m.latestVersion()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version: %d\nlatest: %d\ndirty: %t\n", current, latest, dirty)
+
+	return nil
+}
+
+// Makes sure the database schema matches the embedded migrations before serving requests, applying
+// pending migrations if autoMigrate is set and refusing to start otherwise.
+func checkSchema(db *sql.DB, autoMigrate bool, logger *jsonlog.Logger) error {
+	m, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	current, dirty, err := m.currentVersion()
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("database schema is dirty at version %d, fix it manually and run `api migrate force`", current)
+	}
+
+	latest, err := m.latestVersion()
+	if err != nil {
+		return err
+	}
+
+	if current >= latest {
+		return nil
+	}
+
+	if !autoMigrate {
+		return fmt.Errorf("database schema is at version %d but %d is required, run `api migrate up` or start with -auto-migrate", current, latest)
+	}
+
+	logger.PrintInfo("applying database migrations", map[string]string{
+		"from": strconv.FormatUint(uint64(current), 10),
+		"to":   strconv.FormatUint(uint64(latest), 10),
+	})
+
+	err = m.Up()
+	if errors.Is(err, migrate.ErrNoChange) {
+		// Another instance applied the migrations in the meantime.
+		return nil
+	}
+
+	return err
+}
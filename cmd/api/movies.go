@@ -9,6 +9,9 @@ import (
 	"github.com/ricci2511/greenlight-api/internal/validator"
 )
 
+// Returned from within a transaction when the movie no longer matches the If-Match header of the request.
+var errPreconditionFailed = errors.New("precondition failed")
+
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 	// Decode the request body into an intermediary struct instead of to data.Movie to
 	// prevent a user from sending a JSON containing internal Movie fields like ID or Version.
@@ -39,7 +42,15 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	// The movie and its first revision are written together, so the history never misses a change.
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		err := tx.Movies.Insert(r.Context(), movie)
+		if err != nil {
+			return err
+		}
+
+		return app.recordMovieRevision(tx, r, movie, data.RevisionInsert)
+	})
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -62,7 +73,7 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			app.notFoundReponse(w, r)
@@ -73,7 +84,19 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	// The movie version is used as the ETag, so clients can revalidate cached movies cheaply.
+	etag := app.etag(movie.Version)
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	if match := r.Header.Get("If-None-Match"); match != "" && app.etagMatches(match, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -86,7 +109,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			app.notFoundReponse(w, r)
@@ -97,6 +120,13 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// If the client sent an If-Match header, only update the movie if it still has the expected version.
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !app.etagMatches(ifMatch, app.etag(movie.Version), false) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
 	// Using pointers to have nil as the zero value instead of the zero values like 0, "" and so on.
 	// This way, during validation we can properly differentiate between invalid and missing fields.
 	var input struct {
@@ -136,18 +166,32 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		err := tx.Movies.Update(r.Context(), movie)
+		if err != nil {
+			return err
+		}
+
+		return app.recordMovieRevision(tx, r, movie, data.RevisionUpdate)
+	})
 	if err != nil {
-		if errors.Is(err, data.ErrEditConflict) {
+		switch {
+		// The movie was modified concurrently, so the version the client conditioned on is stale.
+		case errors.Is(err, data.ErrEditConflict) && ifMatch != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
-		} else {
+		default:
 			app.serverErrorResponse(w, r, err)
 		}
 
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", app.etag(movie.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -160,18 +204,43 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	ifMatch := r.Header.Get("If-Match")
+
+	// The last state of the movie is recorded as a delete revision, so it can still be looked up afterwards.
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		movie, err := tx.Movies.Get(r.Context(), id)
+		if err != nil {
+			return err
+		}
+
+		// If the client sent an If-Match header, make sure the movie still has the expected version before deleting it.
+		if ifMatch != "" && !app.etagMatches(ifMatch, app.etag(movie.Version), false) {
+			return errPreconditionFailed
+		}
+
+		err = tx.Movies.Delete(r.Context(), id, movie.Version)
+		if err != nil {
+			return err
+		}
+
+		return app.recordMovieRevision(tx, r, movie, data.RevisionDelete)
+	})
 	if err != nil {
-		if errors.Is(err, data.ErrRecordNotFound) {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundReponse(w, r)
-		} else {
+		case errors.Is(err, errPreconditionFailed), errors.Is(err, data.ErrEditConflict) && ifMatch != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
 			app.serverErrorResponse(w, r, err)
 		}
 
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully moved to the trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -195,6 +264,14 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 
+	// The presence of the cursor parameter switches to keyset pagination, an empty value starts from the first page.
+	input.Filters.UseCursor = qs.Has("cursor")
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+
+	if input.Filters.UseCursor && qs.Has("page") {
+		v.AddError("page", "must not be provided together with cursor")
+	}
+
 	// - sign is used to indicate descending order.
 	input.Filters.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
 
@@ -203,7 +280,7 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(r.Context(), input.Title, input.Genres, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
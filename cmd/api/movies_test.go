@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ricci2511/greenlight-api/internal/data"
+	"github.com/ricci2511/greenlight-api/internal/jsonlog"
+	"github.com/ricci2511/greenlight-api/internal/mailer"
+)
+
+// Returns an application with the default configuration, backed by the in-memory models.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	var cfg config
+	newFlagSet(&cfg, &loadedConfig{})
+
+	cfg.limiter.enabled = false
+	cfg.accessLog.enabled = false
+
+	app := &application{
+		config:          cfg,
+		logger:          jsonlog.New(io.Discard, nil),
+		logLevel:        new(slog.LevelVar),
+		models:          data.NewMemoryModels(),
+		mailer:          mailer.New(mailer.NewMemoryTransport(), cfg.smtp.sender),
+		metricsRegistry: prometheus.NewRegistry(),
+	}
+
+	app.runtimeConfig.Store(&cfg)
+
+	return app
+}
+
+// Creates an activated user with the given role and returns a plaintext authentication token for them.
+func newTestUser(t *testing.T, app *application, email, role string) string {
+	t.Helper()
+
+	ctx := context.Background()
+
+	user := &data.User{Name: "Test", Email: email, Activated: true}
+
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Users.Insert(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Roles.AddForUser(ctx, user.ID, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := app.models.Tokens.New(ctx, user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token.Plaintext
+}
+
+func TestMovieHandlers(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	editor := newTestUser(t, app, "editor@example.com", "editor")
+	viewer := newTestUser(t, app, "viewer@example.com", "viewer")
+	admin := newTestUser(t, app, "admin@example.com", "admin")
+
+	// Valid cursor for the year sort order, except that its value isn't a year.
+	badCursor := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"year","v":"1999'","i":1}`))
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		token      string
+		ifMatch    string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "create",
+			method:     http.MethodPost,
+			url:        "/v1/movies",
+			token:      editor,
+			body:       `{"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation","adventure"]}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "create without movies:write",
+			method:     http.MethodPost,
+			url:        "/v1/movies",
+			token:      viewer,
+			body:       `{"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation"]}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "create invalid",
+			method:     http.MethodPost,
+			url:        "/v1/movies",
+			token:      editor,
+			body:       `{"title":"","year":2016,"runtime":"107 mins","genres":["animation"]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "show",
+			method:     http.MethodGet,
+			url:        "/v1/movies/1",
+			token:      viewer,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "show anonymously",
+			method:     http.MethodGet,
+			url:        "/v1/movies/1",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "show missing",
+			method:     http.MethodGet,
+			url:        "/v1/movies/2",
+			token:      viewer,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "list",
+			method:     http.MethodGet,
+			url:        "/v1/movies?title=moana&sort=-year",
+			token:      viewer,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list with malformed cursor value",
+			method:     http.MethodGet,
+			url:        "/v1/movies?sort=year&cursor=" + badCursor,
+			token:      viewer,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "update with stale If-Match",
+			method:     http.MethodPatch,
+			url:        "/v1/movies/1",
+			token:      editor,
+			ifMatch:    `"5"`,
+			body:       `{"title":"Moana 2"}`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "update",
+			method:     http.MethodPatch,
+			url:        "/v1/movies/1",
+			token:      editor,
+			ifMatch:    `"1"`,
+			body:       `{"title":"Moana 2"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "delete with stale If-Match",
+			method:     http.MethodDelete,
+			url:        "/v1/movies/1",
+			token:      editor,
+			ifMatch:    `"1"`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "delete",
+			method:     http.MethodDelete,
+			url:        "/v1/movies/1",
+			token:      editor,
+			ifMatch:    `"2"`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "show deleted",
+			method:     http.MethodGet,
+			url:        "/v1/movies/1",
+			token:      viewer,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "list revisions of deleted without movies:admin",
+			method:     http.MethodGet,
+			url:        "/v1/movies/1/revisions",
+			token:      viewer,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "show revision of deleted without movies:admin",
+			method:     http.MethodGet,
+			url:        "/v1/movies/1/revisions/1",
+			token:      viewer,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "list revisions of deleted",
+			method:     http.MethodGet,
+			url:        "/v1/movies/1/revisions",
+			token:      admin,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "restore",
+			method:     http.MethodPost,
+			url:        "/v1/movies/1/restore",
+			token:      admin,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "delete with If-Match from before the delete",
+			method:     http.MethodDelete,
+			url:        "/v1/movies/1",
+			token:      editor,
+			ifMatch:    `"2"`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "show revision of restored",
+			method:     http.MethodGet,
+			url:        "/v1/movies/1/revisions/3",
+			token:      viewer,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	// The cases run in order against the same application, each one building on the previous ones.
+	for _, tt := range tests {
+		var body io.Reader
+		if tt.body != "" {
+			body = strings.NewReader(tt.body)
+		}
+
+		r := httptest.NewRequest(tt.method, tt.url, body)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		if tt.ifMatch != "" {
+			r.Header.Set("If-Match", tt.ifMatch)
+		}
+
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: got status %d; want %d, body: %s", tt.name, w.Code, tt.wantStatus, w.Body)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/ricci2511/greenlight-api/internal/data"
+)
+
+const (
+	// Emails are claimed for this long, after which they are retried if the outcome was never reported.
+	outboxLease = 5 * time.Minute
+
+	// Interval at which sent emails and dead letters older than their retention are purged.
+	outboxPurgeInterval = time.Hour
+)
+
+// Delivers the emails in the outbox until the context is cancelled.
+//
+// Each tick claims a batch of due emails, so multiple application instances can run the worker side by side.
+func (app *application) runOutboxWorker(ctx context.Context) {
+	ticker := time.NewTicker(app.config.outbox.pollInterval)
+	defer ticker.Stop()
+
+	purgeTicker := time.NewTicker(outboxPurgeInterval)
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.deliverOutbox(ctx)
+		case <-purgeTicker.C:
+			app.purgeOutbox(ctx)
+		}
+	}
+}
+
+// Permanently deletes sent emails and dead letters that have been kept longer than their retention.
+func (app *application) purgeOutbox(ctx context.Context) {
+	now := time.Now()
+
+	purges := []struct {
+		status string
+		purge  func(ctx context.Context, before time.Time) (int64, error)
+		before time.Time
+	}{
+		{data.EmailStatusSent, app.models.Outbox.PurgeSent, now.Add(-app.config.outbox.sentRetention)},
+		{data.EmailStatusDead, app.models.Outbox.PurgeDead, now.Add(-app.config.outbox.deadRetention)},
+	}
+
+	for _, p := range purges {
+		purged, err := p.purge(ctx, p.before)
+		if err != nil {
+			// Cancelled by the shutdown, the remaining emails are purged on the next run.
+			if ctx.Err() == nil {
+				app.logger.PrintError(err, nil)
+			}
+
+			return
+		}
+
+		if purged > 0 {
+			app.logger.Info("purged emails from the outbox", slog.String("status", p.status), slog.Int64("count", purged))
+		}
+	}
+}
+
+// Claims and delivers due outbox emails until none are left or the context is cancelled.
+//
+// The context is only checked between batches, so that claimed emails are still delivered during shutdown.
+func (app *application) deliverOutbox(ctx context.Context) {
+	for ctx.Err() == nil {
+		emails, err := app.models.Outbox.Claim(context.Background(), app.config.outbox.batchSize, outboxLease)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		if len(emails) == 0 {
+			return
+		}
+
+		for _, email := range emails {
+			app.deliverEmail(email)
+		}
+	}
+}
+
+// Sends a single claimed email and records the outcome.
+func (app *application) deliverEmail(email *data.Email) {
+	ctx := context.Background()
+
+	sendErr := app.mailer.Send(ctx, email.Recipient, email.Template, email.Data)
+	if sendErr == nil {
+		err := app.models.Outbox.MarkSent(ctx, email)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+
+		return
+	}
+
+	// Give up once the maximum number of attempts is reached and keep the email as a dead letter.
+	dead := email.Attempts >= app.config.outbox.maxAttempts
+
+	err := app.models.Outbox.MarkFailed(ctx, email, sendErr, time.Now().Add(outboxBackoff(email.Attempts)), dead)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+
+	attrs := []any{
+		slog.Int64("emailID", email.ID),
+		slog.Int("attempts", email.Attempts),
+		slog.Any("error", sendErr),
+	}
+
+	if dead {
+		app.logger.Error("email delivery failed, giving up", attrs...)
+	} else {
+		app.logger.Warn("email delivery failed, retrying later", attrs...)
+	}
+}
+
+// Returns the delay before the next delivery attempt, which doubles with every failed attempt
+// starting from 30 seconds and is capped at one hour.
+func outboxBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second * time.Duration(math.Pow(2, float64(attempts-1)))
+	if backoff <= 0 || backoff > time.Hour {
+		return time.Hour
+	}
+
+	return backoff
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ricci2511/greenlight-api/internal/validator"
+)
+
+// Reloads the runtime-tunable settings every time the process receives SIGHUP.
+func (app *application) handleReloads() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		err := app.reloadConfig()
+		if err != nil {
+			app.logger.PrintError(fmt.Errorf("reloading config: %w", err), nil)
+			continue
+		}
+
+		cfg := app.runtimeConfig.Load()
+
+		app.logger.PrintInfo("config reloaded", map[string]string{
+			"limiterEnabled":     fmt.Sprint(cfg.limiter.enabled),
+			"limiterRps":         fmt.Sprint(cfg.limiter.rps),
+			"limiterBurst":       fmt.Sprint(cfg.limiter.burst),
+			"corsTrustedOrigins": strings.Join(cfg.cors.trustedOrigins, " "),
+			"logLevel":           (*levelValue)(&cfg.log.level).String(),
+		})
+	}
+}
+
+// Re-reads the configuration from the same sources used at startup and atomically swaps the
+// rate limiter, CORS and log level settings. All other settings still require a restart.
+func (app *application) reloadConfig() error {
+	lc, err := loadConfig(os.Args[1:])
+	if err != nil {
+		return err
+	}
+
+	v := validator.New()
+	if validateConfig(v, lc.cfg); !v.Valid() {
+		return fmt.Errorf("invalid config: %v", v.Errors)
+	}
+
+	cfg := *app.runtimeConfig.Load()
+	cfg.limiter = lc.cfg.limiter
+	cfg.cors = lc.cfg.cors
+	cfg.log.level = lc.cfg.log.level
+
+	app.runtimeConfig.Store(&cfg)
+	app.logLevel.Set(cfg.log.level)
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ricci2511/greenlight-api/internal/data"
+	"github.com/ricci2511/greenlight-api/internal/validator"
+)
+
+// Helper to record the current state of a movie as a revision made by the authenticated user.
+func (app *application) recordMovieRevision(tx data.Models, r *http.Request, movie *data.Movie, operation string) error {
+	user := app.contextGetUser(r)
+
+	return tx.MovieRevisions.Insert(r.Context(), &data.MovieRevision{
+		Operation: operation,
+		UserID:    &user.ID,
+		Movie:     *movie,
+	})
+}
+
+// Helper to check whether the user may see the revision history of a movie.
+//
+// Movies in the trash, or purged from it, keep their history, but it is only visible with the movies:admin permission.
+func (app *application) canViewMovieHistory(r *http.Request, id int64) (bool, error) {
+	_, err := app.models.Movies.Get(r.Context(), id)
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return err == nil, err
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include("movies:admin"), nil
+}
+
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundReponse(w, r)
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "-version")
+	filters.SortSafeList = []string{"version", "-version"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	visible, err := app.canViewMovieHistory(r, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		app.notFoundReponse(w, r)
+		return
+	}
+
+	revisions, metadata, err := app.models.MovieRevisions.GetAllForMovie(r.Context(), id, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Every movie has at least one revision, so a movie without any is unknown.
+	if len(revisions) == 0 && filters.Page == 1 {
+		app.notFoundReponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "revisions": revisions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundReponse(w, r)
+		return
+	}
+
+	version, err := app.readVersionParam(r)
+	if err != nil {
+		app.notFoundReponse(w, r)
+		return
+	}
+
+	visible, err := app.canViewMovieHistory(r, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		app.notFoundReponse(w, r)
+		return
+	}
+
+	revision, err := app.models.MovieRevisions.Get(r.Context(), id, version)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundReponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revision": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Rolls a movie back to the state of an earlier version, which is saved as a new version of the movie.
+func (app *application) restoreMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundReponse(w, r)
+		return
+	}
+
+	version, err := app.readVersionParam(r)
+	if err != nil {
+		app.notFoundReponse(w, r)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+
+	var movie *data.Movie
+
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		revision, err := tx.MovieRevisions.Get(r.Context(), id, version)
+		if err != nil {
+			return err
+		}
+
+		// Only existing movies can be rolled back, a deleted movie has to be restored from the trash first.
+		movie, err = tx.Movies.Get(r.Context(), id)
+		if err != nil {
+			return err
+		}
+
+		// If the client sent an If-Match header, only roll back the movie if it still has the expected version.
+		if ifMatch != "" && !app.etagMatches(ifMatch, app.etag(movie.Version), false) {
+			return errPreconditionFailed
+		}
+
+		movie.Title = revision.Movie.Title
+		movie.Year = revision.Movie.Year
+		movie.Runtime = revision.Movie.Runtime
+		movie.Genres = revision.Movie.Genres
+
+		err = tx.Movies.Update(r.Context(), movie)
+		if err != nil {
+			return err
+		}
+
+		return app.recordMovieRevision(tx, r, movie, data.RevisionRestore)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundReponse(w, r)
+		case errors.Is(err, errPreconditionFailed), errors.Is(err, data.ErrEditConflict) && ifMatch != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.etag(movie.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
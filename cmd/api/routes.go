@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func (app *application) routes() http.Handler {
@@ -16,39 +17,73 @@ func (app *application) routes() http.Handler {
 	r.MethodNotAllowed(app.methodNotAllowedRespone)
 
 	// Standard middleware stack.
+	r.Use(app.requestID)
+	// Get client's real IP through the X-Forwarded-For header set by Caddy's reverse proxy.
+	// If not used, the rate limiter will limit the ip of the reverse proxy instead of the client.
+	// Runs before the access log, so that it logs the client's IP as well.
+	r.Use(middleware.RealIP)
+	r.Use(app.trace)
+	r.Use(app.accessLog)
 	r.Use(middleware.CleanPath)
 	r.Use(app.authenticate)
 	r.Use(app.rateLimit)
 	r.Use(app.enableCors)
-	// Get client's real IP through the X-Forwarded-For header set by Caddy's reverse proxy.
-	// If not used, the rate limiter will limit the ip of the reverse proxy instead of the client.
-	r.Use(middleware.RealIP)
 	r.Use(app.recoverPanic)
 	r.Use(app.metrics)
 
 	r.Get("/v1/healthcheck", app.healthcheckHandler)
+	r.Get("/v1/healthz/live", app.livenessHandler)
+	r.Get("/v1/healthz/ready", app.readinessHandler)
 
 	r.Route("/v1/users", func(r chi.Router) {
 		r.Post("/", app.createUserHandler)
 		r.Put("/activate", app.activateUserHandler)
 		r.Put("/password", app.updateUserPasswordHandler)
+
+		r.Get("/me/sessions", app.requireAuthenticatedUser(app.listSessionsHandler))
+		r.Delete("/me/sessions/{id}", app.requireAuthenticatedUser(app.deleteSessionHandler))
+
+		r.Get("/{id}/permissions", app.requirePermission("permissions:admin", app.listUserPermissionsHandler))
+		r.Post("/{id}/permissions", app.requirePermission("permissions:admin", app.grantUserPermissionsHandler))
+		r.Delete("/{id}/permissions/{code}", app.requirePermission("permissions:admin", app.revokeUserPermissionHandler))
+
+		r.Get("/{id}/roles", app.requirePermission("permissions:admin", app.listUserRolesHandler))
+		r.Post("/{id}/roles", app.requirePermission("permissions:admin", app.assignUserRolesHandler))
+		r.Delete("/{id}/roles/{role}", app.requirePermission("permissions:admin", app.unassignUserRoleHandler))
 	})
 
 	r.Route("/v1/tokens", func(r chi.Router) {
 		r.Post("/authentication", app.createAuthenticationTokenHandler)
+		r.Delete("/authentication", app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler))
+		r.Post("/refresh", app.refreshAuthenticationTokenHandler)
 		r.Post("/password-reset", app.createPasswordResetTokenHandler)
+		r.Post("/activation", app.createActivationTokenHandler)
+	})
+
+	r.Route("/v1/permissions", func(r chi.Router) {
+		r.Get("/", app.requirePermission("permissions:admin", app.listPermissionsHandler))
+		r.Post("/", app.requirePermission("permissions:admin", app.createPermissionHandler))
 	})
 
+	r.Get("/v1/roles", app.requirePermission("permissions:admin", app.listRolesHandler))
+
 	r.Route("/v1/movies", func(r chi.Router) {
 		r.Post("/", app.requirePermission("movies:write", app.createMovieHandler))
 		r.Get("/", app.requirePermission("movies:read", app.listMoviesHandler))
+		r.Get("/trash", app.requirePermission("movies:admin", app.listTrashHandler))
 
 		r.Get("/{id}", app.requirePermission("movies:read", app.showMovieHandler))
 		r.Patch("/{id}", app.requirePermission("movies:write", app.updateMovieHandler))
 		r.Delete("/{id}", app.requirePermission("movies:write", app.deleteMovieHandler))
+		r.Post("/{id}/restore", app.requirePermission("movies:admin", app.restoreMovieHandler))
+
+		r.Get("/{id}/revisions", app.requirePermission("movies:read", app.listMovieRevisionsHandler))
+		r.Get("/{id}/revisions/{version}", app.requirePermission("movies:read", app.showMovieRevisionHandler))
+		r.Post("/{id}/revisions/{version}/restore", app.requirePermission("movies:write", app.restoreMovieRevisionHandler))
 	})
 
 	r.Mount("/debug/vars", expvar.Handler())
+	r.Handle("/metrics", promhttp.HandlerFor(app.metricsRegistry, promhttp.HandlerOpts{}))
 
 	return r
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,16 +15,41 @@ import (
 
 // Initializes the applications http.Server.
 func (app *application) serve() error {
+	// Parent of every request context, cancelled once the graceful shutdown times out so that
+	// requests still running at that point have their queries aborted.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", app.config.port),
 		Handler:      app.routes(),
+		ErrorLog:     log.New(app.logger, "", 0),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
 	}
 
 	shutdownError := make(chan error)
 
+	// Background workers run until the server shuts down.
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	// Deliver the email outbox.
+	app.background(func() {
+		app.runOutboxWorker(workersCtx)
+	})
+
+	// Purge movies whose trash retention has expired.
+	app.background(func() {
+		app.runTrashPurger(workersCtx)
+	})
+
+	go app.handleReloads()
+
 	// Background goroutine to gracefully shutdown the server.
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -36,11 +63,17 @@ func (app *application) serve() error {
 			"signal": s.String(),
 		})
 
+		// Fail the readiness check first, giving the load balancer time to stop routing
+		// new requests to this instance before the listener is closed.
+		app.shuttingDown.Store(true)
+		time.Sleep(app.config.shutdown.drainPeriod)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
 		err := srv.Shutdown(ctx)
 		if err != nil {
+			cancelRequests()
 			shutdownError <- err
 		}
 
@@ -48,6 +81,8 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		stopWorkers()
+
 		// Block until all background goroutines have completed.
 		app.wg.Wait()
 
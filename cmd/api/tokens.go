@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -31,7 +32,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			v.AddError("email", "no user exists with this email address")
@@ -54,13 +55,170 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	// Every login starts a new token family, which is shared by all the tokens rotated from it.
+	family, err := data.NewTokenFamily()
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	var authenticationToken, refreshToken *data.Token
+
+	// Both tokens are issued together, so a login never ends up with only one of them.
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		var err error
+
+		authenticationToken, refreshToken, err = app.newAuthenticationTokens(tx, r, user.ID, family)
+		return err
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	res := envelope{"authentication_token": authenticationToken, "refresh_token": refreshToken}
+	err = app.writeJSON(w, http.StatusCreated, res, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := app.models.Tokens.GetByPlaintext(r.Context(), data.ScopeRefresh, input.TokenPlaintext)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.invalidRefreshTokenResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	// Refresh tokens can only be exchanged once. If it was already used, it has most likely been stolen,
+	// so every token of its family is revoked and the user has to log in again.
+	if token.Used {
+		app.revokeTokenFamily(w, r, token.Family)
+		return
+	}
+
+	var authenticationToken, refreshToken *data.Token
+
+	// The rotation is atomic, otherwise a failure after marking the refresh token as used
+	// would make the client's retry look like token reuse and log the user out.
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		err := tx.Tokens.MarkUsed(r.Context(), token)
+		if err != nil {
+			return err
+		}
+
+		// Rotate the authentication token as well, so that only one is active per token family.
+		err = tx.Tokens.DeleteAllForFamily(r.Context(), data.ScopeAuthentication, token.Family)
+		if err != nil {
+			return err
+		}
+
+		authenticationToken, refreshToken, err = app.newAuthenticationTokens(tx, r, token.UserId, token.Family)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrTokenReused) {
+			app.revokeTokenFamily(w, r, token.Family)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	res := envelope{"authentication_token": authenticationToken, "refresh_token": refreshToken}
+	err = app.writeJSON(w, http.StatusCreated, res, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	// Logging out of all sessions is opted into with ?all=true.
+	all := app.readBool(r.URL.Query(), "all", false, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if all {
+		// Both scopes are deleted together, so a failure can't leave refresh tokens behind
+		// that are able to issue new authentication tokens.
+		err := app.models.Transaction(r.Context(), func(tx data.Models) error {
+			for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+				err := tx.Tokens.DeleteAllForUser(r.Context(), scope, user.ID)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"message": "successfully logged out of all sessions"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	// The authenticate middleware already made sure that the Authorization header contains a valid token.
+	token, err := app.models.Tokens.GetByPlaintext(r.Context(), data.ScopeAuthentication, app.readBearerToken(r))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.invalidAuthenticationTokenResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	// Tokens issued before token families existed can only be deleted individually.
+	if token.Family != nil {
+		err = app.models.Tokens.DeleteFamily(r.Context(), token.Family)
+	} else {
+		err = app.models.Tokens.Delete(r.Context(), token)
+	}
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "successfully logged out"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -87,7 +245,7 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			v.AddError("email", "no matching email address found")
@@ -106,27 +264,133 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	// Queue an email with the password reset token in the same transaction as the token itself.
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		token, err := tx.Tokens.New(r.Context(), user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		return tx.Outbox.Insert(r.Context(), &data.Email{
+			Recipient: user.Email,
+			Template:  "token_password_reset.html",
+			Data: map[string]any{
+				"passwordResetToken": token.Plaintext,
+			},
+		})
+	})
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Send the user an email with the password reset token in a background goroutine.
-	app.background(func() {
-		data := map[string]any{
-			"passwordResetToken": token.Plaintext,
+	res := envelope{"message": "an email will be sent to you containing the password reset instructions"}
+	err = app.writeJSON(w, http.StatusAccepted, res, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("email", "no matching email address found")
+			app.failedValidationResponse(w, r, v.Errors)
+		} else {
+			app.serverErrorResponse(w, r, err)
 		}
 
-		err := app.mailer.Send(user.Email, "token_password_reset.html", data)
+		return
+	}
+
+	if user.Activated {
+		v.AddError("email", "user has already been activated")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		// Invalidate any previously sent activation tokens, so that only the newest one works.
+		err := tx.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.ID)
+		if err != nil {
+			return err
+		}
+
+		token, err := tx.Tokens.New(r.Context(), user.ID, 3*24*time.Hour, data.ScopeActivation)
 		if err != nil {
-			app.logger.PrintError(err, nil)
+			return err
 		}
+
+		// Queue an email with the activation token in the same transaction as the token itself.
+		return tx.Outbox.Insert(r.Context(), &data.Email{
+			Recipient: user.Email,
+			Template:  "token_activation.html",
+			Data: map[string]any{
+				"activationToken": token.Plaintext,
+			},
+		})
 	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
-	res := envelope{"message": "an email will be sent to you containing the password reset instructions"}
+	res := envelope{"message": "an email will be sent to you containing activation instructions"}
 	err = app.writeJSON(w, http.StatusAccepted, res, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// Helper to issue a new pair of authentication and refresh tokens within a token family,
+// using the given models so the tokens can be issued as part of a transaction.
+//
+// The client IP and user agent of the request are recorded, so users can recognize their sessions.
+func (app *application) newAuthenticationTokens(models data.Models, r *http.Request, userID int64, family []byte) (*data.Token, *data.Token, error) {
+	ip, userAgent := app.clientIP(r), r.UserAgent()
+
+	authenticationToken, err := models.Tokens.NewInFamily(r.Context(), userID, 24*time.Hour, data.ScopeAuthentication, family, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken, err := models.Tokens.NewInFamily(r.Context(), userID, 30*24*time.Hour, data.ScopeRefresh, family, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return authenticationToken, refreshToken, nil
+}
+
+// Helper to revoke all tokens of a family after refresh token reuse was detected.
+func (app *application) revokeTokenFamily(w http.ResponseWriter, r *http.Request, family []byte) {
+	app.logger.WarnContext(r.Context(), "refresh token reuse detected, revoking token family",
+		slog.String("requestURL", r.URL.String()),
+	)
+
+	err := app.models.Tokens.DeleteFamily(r.Context(), family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.invalidRefreshTokenResponse(w, r)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ricci2511/greenlight-api/internal/data"
+	"github.com/ricci2511/greenlight-api/internal/validator"
+)
+
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	filters.SortSafeList = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllDeleted(r.Context(), filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "movies": movies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Takes a deleted movie out of the trash, which is only possible until it is purged.
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundReponse(w, r)
+		return
+	}
+
+	var movie *data.Movie
+
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		var err error
+
+		movie, err = tx.Movies.Restore(r.Context(), id)
+		if err != nil {
+			return err
+		}
+
+		return app.recordMovieRevision(tx, r, movie, data.RevisionUndelete)
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundReponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.etag(movie.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Permanently deletes movies that have been in the trash longer than the retention, until the context is cancelled.
+func (app *application) runTrashPurger(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.purgeTrash(ctx)
+		}
+	}
+}
+
+func (app *application) purgeTrash(ctx context.Context) {
+	purged, err := app.models.Movies.PurgeDeleted(ctx, time.Now().Add(-app.config.trash.retention))
+	if err != nil {
+		// Cancelled by the shutdown, the remaining movies are purged on the next start.
+		if ctx.Err() == nil {
+			app.logger.PrintError(err, nil)
+		}
+
+		return
+	}
+
+	if purged > 0 {
+		app.logger.Info("purged movies from the trash", slog.Int64("count", purged))
+	}
+}
@@ -42,7 +42,36 @@ func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	// The user, their role, activation token and welcome email are written atomically,
+	// so a failure midway can't leave behind a user that is unable to activate their account.
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		err := tx.Users.Insert(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		// All new users start with the viewer role, which grants the movies:read permission.
+		err = tx.Roles.AddForUser(r.Context(), user.ID, "viewer")
+		if err != nil {
+			return err
+		}
+
+		token, err := tx.Tokens.New(r.Context(), user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			return err
+		}
+
+		// Send the user a welcome email after they successfully register.
+		// Delivered by the outbox worker to avoid bottlenecking the main request.
+		return tx.Outbox.Insert(r.Context(), &data.Email{
+			Recipient: user.Email,
+			Template:  "user_welcome.html",
+			Data: map[string]any{
+				"name":            user.Name,
+				"activationToken": token.Plaintext,
+			},
+		})
+	})
 	if err != nil {
 		if errors.Is(err, data.ErrDuplicateEmail) {
 			v.AddError("email", "a user with this email address already exists")
@@ -54,33 +83,6 @@ func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// All new users start with the movies:read permission.
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Send the user a welcome email after they successfully register.
-	// Runs concurrently to avoid bottlenecking the main request.
-	app.background(func() {
-		data := map[string]any{
-			"name":            user.Name,
-			"activationToken": token.Plaintext,
-		}
-
-		err = app.mailer.Send(user.Email, "user_welcome.html", data)
-		if err != nil {
-			app.logger.PrintError(err, nil)
-		}
-	})
-
 	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -106,7 +108,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Retrieve the user record that the activation token belongs to.
-	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
+	user, err := app.models.Users.GetForToken(r.Context(), data.ScopeActivation, input.TokenPlaintext)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			v.AddError("token", "invalid or expired activation token")
@@ -120,8 +122,18 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 	user.Activated = true
 
-	// Update the user with "activated" set to true.
-	err = app.models.Users.Update(user)
+	// Activating the user and consuming their activation tokens happen atomically,
+	// so a failure midway can't leave behind a token that activates the user again.
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		// Update the user with "activated" set to true.
+		err := tx.Users.Update(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		// Once activated, delete any existing activation tokens related to the user.
+		return tx.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.ID)
+	})
 	if err != nil {
 		if errors.Is(err, data.ErrEditConflict) {
 			app.editConflictResponse(w, r)
@@ -132,13 +144,6 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Once activated, delete any existing activation tokens related to the user.
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
 	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -168,7 +173,7 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 	}
 
 	// Retrieve the user record that the password reset token belongs to.
-	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	user, err := app.models.Users.GetForToken(r.Context(), data.ScopePasswordReset, input.TokenPlaintext)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			v.AddError("token", "invalid or expired password reset token")
@@ -187,8 +192,18 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	// Update the user record in the DB.
-	err = app.models.Users.Update(user)
+	// The new password and the deletion of the reset tokens are committed together,
+	// so a reset token can never be used again once the password has changed.
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		// Update the user record in the DB.
+		err := tx.Users.Update(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		// On success delete the password reset token record from the DB.
+		return tx.Tokens.DeleteAllForUser(r.Context(), data.ScopePasswordReset, user.ID)
+	})
 	if err != nil {
 		if errors.Is(err, data.ErrEditConflict) {
 			app.editConflictResponse(w, r)
@@ -199,13 +214,6 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	// On success delete the password reset token record from the DB.
-	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
 	res := envelope{"message": "your password was successfully reset"}
 	err = app.writeJSON(w, http.StatusAccepted, res, nil)
 	if err != nil {
@@ -1,7 +1,11 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"math"
+	"strconv"
 	"strings"
 
 	"github.com/ricci2511/greenlight-api/internal/validator"
@@ -12,6 +16,43 @@ type Filters struct {
 	PageSize     int      // Number of records per page
 	Sort         string   // Field name to sort by
 	SortSafeList []string // List of allowed field names to sort by
+	Cursor       string   // Opaque keyset pagination cursor, empty for the first page
+	UseCursor    bool     // Use keyset pagination with Cursor instead of Page
+}
+
+// Position of the last record of a page when using keyset pagination.
+//
+// The sort key is stored alongside the value so a cursor can't be reused with a different sort order.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"i"`
+}
+
+// Bit sizes of the sort columns holding integers, cursor values of other columns are compared as text.
+var integerSortColumns = map[string]int{"id": 64, "year": 32, "runtime": 32}
+
+// Encodes a cursor into an opaque URL-safe string.
+func (c cursor) encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// Decodes a cursor string previously created with encode().
+func decodeCursor(s string) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cursor
+
+	err = json.Unmarshal(js, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
 }
 
 // Runs validation checks on the filter parameters provided by the client.
@@ -21,6 +62,22 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize > 0, "pageSize", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "pageSize", "must be a maximum of 100")
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	if f.UseCursor && f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		if err != nil {
+			v.AddError("cursor", "invalid cursor value")
+			return
+		}
+
+		v.Check(c.Sort == f.Sort, "cursor", "must be used with the same sort value it was created with")
+
+		// The value is passed to the query as is, so it has to match the type of the sort column.
+		if bitSize, ok := integerSortColumns[strings.TrimPrefix(c.Sort, "-")]; ok && c.Sort == f.Sort {
+			_, err := strconv.ParseInt(c.Value, 10, bitSize)
+			v.Check(err == nil, "cursor", "invalid cursor value")
+		}
+	}
 }
 
 // Returns the column name to sort by based on the Sort field value provided by the client.
@@ -57,12 +114,37 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// Returns the cursor decoded from the Cursor field, or nil if pagination starts from the first record.
+func (f Filters) cursor() (*cursor, error) {
+	if f.Cursor == "" {
+		return nil, nil
+	}
+
+	return decodeCursor(f.Cursor)
+}
+
+// Returns the SQL condition that selects the records placed after the cursor in the sort order.
+//
+// The placeholders for the cursor's sort value and id start at the given parameter number.
+func (f Filters) cursorCondition(param int) string {
+	op := ">"
+	if f.sortDirection() == "DESC" {
+		op = "<"
+	}
+
+	column := f.sortColumn()
+
+	// Ties on the sort column are broken by the id, which is always sorted in ascending order.
+	return fmt.Sprintf("(%[1]s %[2]s $%[3]d OR (%[1]s = $%[3]d AND id > $%[4]d))", column, op, param, param+1)
+}
+
 type Metadata struct {
-	CurrentPage  int `json:"currentPage,omitempty"`
-	PageSize     int `json:"pageSize,omitempty"`
-	FirstPage    int `json:"firstPage,omitempty"`
-	LastPage     int `json:"lastPage,omitempty"`
-	TotalRecords int `json:"totalRecords,omitempty"`
+	CurrentPage  int    `json:"currentPage,omitempty"`
+	PageSize     int    `json:"pageSize,omitempty"`
+	FirstPage    int    `json:"firstPage,omitempty"`
+	LastPage     int    `json:"lastPage,omitempty"`
+	TotalRecords int    `json:"totalRecords,omitempty"`
+	NextCursor   string `json:"nextCursor,omitempty"`
 }
 
 // Returns a Metadata struct containing metadata for pagination.
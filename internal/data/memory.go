@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+// Returns models that keep all records in memory instead of PostgreSQL, meant for hermetic handler tests.
+//
+// The models mirror the semantics of the SQL models, including version conflicts, unique constraints,
+// token expiry and title search. Like the migrations, they are seeded with the default permissions and roles.
+func NewMemoryModels() Models {
+	s := &memoryStore{mu: new(sync.Mutex), data: newMemoryData()}
+
+	return newMemoryModels(s)
+}
+
+func newMemoryModels(s *memoryStore) Models {
+	return Models{
+		Movies:         memoryMovieModel{s},
+		MovieRevisions: memoryMovieRevisionModel{s},
+		Users:          memoryUserModel{s},
+		Tokens:         memoryTokenModel{s},
+		Permissions:    memoryPermissionModel{s},
+		Roles:          memoryRoleModel{s},
+		Outbox:         memoryOutboxModel{s},
+		store:          s,
+	}
+}
+
+// Store holding the in-memory tables, guarded by a mutex that a transaction holds until it finishes.
+//
+// Models of a transaction must not be used together with the models of the outer store,
+// since the outer models block until the transaction is done.
+type memoryStore struct {
+	mu   *sync.Mutex
+	data *memoryData
+	inTx bool
+}
+
+// Locks the store for a single operation, which is a no-op within a transaction since it already holds the lock.
+func (s *memoryStore) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// Runs fn while holding the store lock and restores a snapshot of all tables if fn fails.
+func (s *memoryStore) transaction(ctx context.Context, m Models, fn func(tx Models) error) error {
+	if s.inTx {
+		return fn(m)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.data.clone()
+
+	err := fn(newMemoryModels(&memoryStore{mu: s.mu, data: s.data, inTx: true}))
+	if err != nil {
+		*s.data = *snapshot
+		return err
+	}
+
+	return nil
+}
+
+func (s *memoryStore) ping(ctx context.Context) error {
+	return nil
+}
+
+// In-memory equivalent of the database tables, records are stored by value so callers can't mutate them.
+type memoryData struct {
+	movies           map[int64]Movie
+	movieRevisions   map[int64]MovieRevision
+	users            map[int64]User
+	tokens           map[string]memoryToken // Keyed by token hash
+	permissions      map[int64]Permission
+	usersPermissions map[[2]int64]bool // Set of (user id, permission id) pairs
+	roles            map[int64]memoryRole
+	usersRoles       map[[2]int64]bool // Set of (user id, role id) pairs
+	emails           map[int64]memoryEmail
+
+	// Last id handed out per table, like the bigserial sequences.
+	sequences map[string]int64
+}
+
+func newMemoryData() *memoryData {
+	d := &memoryData{
+		movies:           make(map[int64]Movie),
+		movieRevisions:   make(map[int64]MovieRevision),
+		users:            make(map[int64]User),
+		tokens:           make(map[string]memoryToken),
+		permissions:      make(map[int64]Permission),
+		usersPermissions: make(map[[2]int64]bool),
+		roles:            make(map[int64]memoryRole),
+		usersRoles:       make(map[[2]int64]bool),
+		emails:           make(map[int64]memoryEmail),
+		sequences:        make(map[string]int64),
+	}
+
+	for _, code := range []string{"movies:read", "movies:write", "permissions:admin", "movies:admin"} {
+		id := d.nextID("permissions")
+		d.permissions[id] = Permission{ID: id, Code: code}
+	}
+
+	seededRoles := []memoryRole{
+		{name: "viewer", permissions: []string{"movies:read"}},
+		{name: "editor", permissions: []string{"movies:read", "movies:write"}},
+		{name: "admin", permissions: []string{"movies:read", "movies:write", "permissions:admin", "movies:admin"}},
+	}
+
+	for _, role := range seededRoles {
+		id := d.nextID("roles")
+		d.roles[id] = role
+	}
+
+	return d
+}
+
+func (d *memoryData) nextID(table string) int64 {
+	d.sequences[table]++
+	return d.sequences[table]
+}
+
+// Returns a copy of all tables, used to roll back failed transactions.
+//
+// Records are immutable once stored, replacing a record always stores a new value, so copying the maps is enough.
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		movies:           maps.Clone(d.movies),
+		movieRevisions:   maps.Clone(d.movieRevisions),
+		users:            maps.Clone(d.users),
+		tokens:           maps.Clone(d.tokens),
+		permissions:      maps.Clone(d.permissions),
+		usersPermissions: maps.Clone(d.usersPermissions),
+		roles:            maps.Clone(d.roles),
+		usersRoles:       maps.Clone(d.usersRoles),
+		emails:           maps.Clone(d.emails),
+		sequences:        maps.Clone(d.sequences),
+	}
+}
@@ -0,0 +1,321 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type memoryMovieModel struct {
+	s *memoryStore
+}
+
+func (m memoryMovieModel) Insert(ctx context.Context, movie *Movie) error {
+	defer m.s.lock()()
+
+	movie.ID = m.s.data.nextID("movies")
+	movie.CreatedAt = time.Now().Truncate(time.Second)
+	movie.Version = 1
+
+	m.s.data.movies[movie.ID] = copyMovie(*movie)
+
+	return nil
+}
+
+func (m memoryMovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
+	defer m.s.lock()()
+
+	movie, ok := m.s.data.movies[id]
+	if !ok || movie.DeletedAt != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	movie = copyMovie(movie)
+
+	return &movie, nil
+}
+
+func (m memoryMovieModel) Update(ctx context.Context, movie *Movie) error {
+	defer m.s.lock()()
+
+	stored, ok := m.s.data.movies[movie.ID]
+	if !ok || stored.Version != movie.Version || stored.DeletedAt != nil {
+		return ErrEditConflict
+	}
+
+	movie.Version++
+	movie.CreatedAt = stored.CreatedAt
+
+	m.s.data.movies[movie.ID] = copyMovie(*movie)
+
+	return nil
+}
+
+func (m memoryMovieModel) Delete(ctx context.Context, id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	defer m.s.lock()()
+
+	movie, ok := m.s.data.movies[id]
+	if !ok || movie.Version != version || movie.DeletedAt != nil {
+		return ErrEditConflict
+	}
+
+	now := time.Now().Truncate(time.Second)
+	movie.DeletedAt = &now
+
+	m.s.data.movies[id] = movie
+
+	return nil
+}
+
+func (m memoryMovieModel) GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	defer m.s.lock()()
+
+	column := filters.sortColumn()
+	descending := filters.sortDirection() == "DESC"
+
+	var c *cursor
+	if filters.UseCursor {
+		var err error
+
+		c, err = filters.cursor()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	matches := []*Movie{}
+
+	for _, movie := range m.s.data.movies {
+		if movie.DeletedAt != nil || !matchesTitle(movie.Title, title) || !containsAll(movie.Genres, genres) {
+			continue
+		}
+
+		// Keep only the movies placed after the cursor, ties are broken by the id in ascending order.
+		if c != nil {
+			cmp := compareSortValue(movie, column, c.Value)
+			if descending {
+				cmp = -cmp
+			}
+
+			if cmp < 0 || (cmp == 0 && movie.ID <= c.ID) {
+				continue
+			}
+		}
+
+		movie := copyMovie(movie)
+		matches = append(matches, &movie)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		cmp := compareSortValue(*matches[i], column, matches[j].sortValue(column))
+		if descending {
+			cmp = -cmp
+		}
+
+		if cmp != 0 {
+			return cmp < 0
+		}
+
+		return matches[i].ID < matches[j].ID
+	})
+
+	if filters.UseCursor {
+		metadata := Metadata{PageSize: filters.PageSize}
+
+		if len(matches) > filters.PageSize {
+			matches = matches[:filters.PageSize]
+			last := matches[len(matches)-1]
+
+			metadata.NextCursor = cursor{
+				Sort:  filters.Sort,
+				Value: last.sortValue(column),
+				ID:    last.ID,
+			}.encode()
+		}
+
+		return matches, metadata, nil
+	}
+
+	totalRecords := len(matches)
+	start := min(filters.offset(), totalRecords)
+	end := min(start+filters.limit(), totalRecords)
+
+	// Like the SQL model, an out of range page yields no metadata since no rows carry the total count.
+	metadata := Metadata{}
+	if start < end {
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	}
+
+	return matches[start:end], metadata, nil
+}
+
+func (m memoryMovieModel) GetAllDeleted(ctx context.Context, filters Filters) ([]*Movie, Metadata, error) {
+	defer m.s.lock()()
+
+	column := filters.sortColumn()
+	descending := filters.sortDirection() == "DESC"
+
+	matches := []*Movie{}
+
+	for _, movie := range m.s.data.movies {
+		if movie.DeletedAt != nil {
+			movie := copyMovie(movie)
+			matches = append(matches, &movie)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		var cmp int
+		if column == "deleted_at" {
+			cmp = matches[i].DeletedAt.Compare(*matches[j].DeletedAt)
+		} else {
+			cmp = compareSortValue(*matches[i], column, matches[j].sortValue(column))
+		}
+
+		if descending {
+			cmp = -cmp
+		}
+
+		if cmp != 0 {
+			return cmp < 0
+		}
+
+		return matches[i].ID < matches[j].ID
+	})
+
+	totalRecords := len(matches)
+	start := min(filters.offset(), totalRecords)
+	end := min(start+filters.limit(), totalRecords)
+
+	// Like the SQL model, an out of range page yields no metadata since no rows carry the total count.
+	metadata := Metadata{}
+	if start < end {
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	}
+
+	return matches[start:end], metadata, nil
+}
+
+func (m memoryMovieModel) Restore(ctx context.Context, id int64) (*Movie, error) {
+	defer m.s.lock()()
+
+	movie, ok := m.s.data.movies[id]
+	if !ok || movie.DeletedAt == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	movie.DeletedAt = nil
+	movie.Version++
+	m.s.data.movies[id] = movie
+
+	movie = copyMovie(movie)
+
+	return &movie, nil
+}
+
+func (m memoryMovieModel) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	defer m.s.lock()()
+
+	var purged int64
+
+	for id, movie := range m.s.data.movies {
+		if movie.DeletedAt != nil && movie.DeletedAt.Before(before) {
+			delete(m.s.data.movies, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// Compares the given sort column of a movie with a sort value produced by Movie.sortValue().
+//
+// Titles are compared byte-wise, while PostgreSQL orders them by the collation of the database, which
+// usually ignores case on the first pass. E.g. "alien" sorts before "Brazil" in PostgreSQL but after it here,
+// so sorting by title only matches the SQL model for titles of the same case.
+func compareSortValue(movie Movie, column, value string) int {
+	if column == "title" {
+		return strings.Compare(movie.Title, value)
+	}
+
+	n, _ := strconv.ParseInt(value, 10, 64)
+
+	var field int64
+	switch column {
+	case "year":
+		field = int64(movie.Year)
+	case "runtime":
+		field = int64(movie.Runtime)
+	default:
+		field = movie.ID
+	}
+
+	switch {
+	case field < n:
+		return -1
+	case field > n:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Mirrors to_tsvector('simple', title) @@ plainto_tsquery('simple', query): every word of the
+// query has to appear in the title, ignoring case and punctuation. An empty query matches everything.
+func matchesTitle(title, query string) bool {
+	if query == "" {
+		return true
+	}
+
+	queryWords := searchWords(query)
+	if len(queryWords) == 0 {
+		return false
+	}
+
+	titleWords := searchWords(title)
+
+	for _, word := range queryWords {
+		if !slices.Contains(titleWords, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Mirrors the genres @> $2 array containment check.
+func containsAll(values, required []string) bool {
+	for _, value := range required {
+		if !slices.Contains(values, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns a copy of the movie that doesn't share the genres slice or deletion time with the original.
+func copyMovie(movie Movie) Movie {
+	movie.Genres = slices.Clone(movie.Genres)
+
+	if movie.DeletedAt != nil {
+		deletedAt := *movie.DeletedAt
+		movie.DeletedAt = &deletedAt
+	}
+
+	return movie
+}
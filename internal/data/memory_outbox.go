@@ -0,0 +1,186 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Email as stored in the outbox_emails table, with the template data encoded as JSON.
+type memoryEmail struct {
+	Email
+	data []byte
+}
+
+type memoryOutboxModel struct {
+	s *memoryStore
+}
+
+func (m memoryOutboxModel) Insert(ctx context.Context, email *Email) error {
+	// Encode the data like the jsonb column does, so claimed emails see the same decoded types.
+	js, err := json.Marshal(email.Data)
+	if err != nil {
+		return err
+	}
+
+	defer m.s.lock()()
+
+	email.ID = m.s.data.nextID("outbox_emails")
+	email.CreatedAt = time.Now()
+	email.Status = EmailStatusPending
+	email.NextAttemptAt = email.CreatedAt
+
+	stored := *email
+	stored.Data = nil
+
+	m.s.data.emails[email.ID] = memoryEmail{Email: stored, data: js}
+
+	return nil
+}
+
+func (m memoryOutboxModel) Claim(ctx context.Context, limit int, lease time.Duration) ([]*Email, error) {
+	defer m.s.lock()()
+
+	now := time.Now()
+
+	due := []memoryEmail{}
+
+	for _, email := range m.s.data.emails {
+		if email.Status == EmailStatusPending && !email.NextAttemptAt.After(now) {
+			due = append(due, email)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	emails := []*Email{}
+
+	for _, stored := range due {
+		stored.Attempts++
+		stored.NextAttemptAt = now.Add(lease)
+		m.s.data.emails[stored.ID] = stored
+
+		email := stored.Email
+
+		err := json.Unmarshal(stored.data, &email.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, &email)
+	}
+
+	return emails, nil
+}
+
+func (m memoryOutboxModel) MarkSent(ctx context.Context, email *Email) error {
+	defer m.s.lock()()
+
+	now := time.Now()
+
+	stored, ok := m.s.data.emails[email.ID]
+	if ok {
+		stored.Status = EmailStatusSent
+		stored.SentAt = &now
+		stored.LastError = ""
+		stored.data = []byte("{}")
+		m.s.data.emails[email.ID] = stored
+	}
+
+	email.Status = EmailStatusSent
+	email.SentAt = &now
+	email.Data = map[string]any{}
+
+	return nil
+}
+
+func (m memoryOutboxModel) MarkFailed(ctx context.Context, email *Email, deliveryErr error, nextAttempt time.Time, dead bool) error {
+	defer m.s.lock()()
+
+	status := EmailStatusPending
+	if dead {
+		status = EmailStatusDead
+	}
+
+	var deadAt *time.Time
+	if dead {
+		now := time.Now()
+		deadAt = &now
+	}
+
+	stored, ok := m.s.data.emails[email.ID]
+	if ok {
+		stored.Status = status
+		stored.NextAttemptAt = nextAttempt
+		stored.LastError = deliveryErr.Error()
+		stored.DeadAt = deadAt
+		if dead {
+			stored.data = []byte("{}")
+		}
+		m.s.data.emails[email.ID] = stored
+	}
+
+	email.Status = status
+	email.NextAttemptAt = nextAttempt
+	email.LastError = deliveryErr.Error()
+	email.DeadAt = deadAt
+
+	if dead {
+		email.Data = map[string]any{}
+	}
+
+	return nil
+}
+
+func (m memoryOutboxModel) PurgeDead(ctx context.Context, before time.Time) (int64, error) {
+	defer m.s.lock()()
+
+	var purged int64
+
+	for id, email := range m.s.data.emails {
+		if email.Status == EmailStatusDead && email.DeadAt != nil && email.DeadAt.Before(before) {
+			delete(m.s.data.emails, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (m memoryOutboxModel) PurgeSent(ctx context.Context, before time.Time) (int64, error) {
+	defer m.s.lock()()
+
+	var purged int64
+
+	for id, email := range m.s.data.emails {
+		if email.Status == EmailStatusSent && email.SentAt != nil && email.SentAt.Before(before) {
+			delete(m.s.data.emails, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (m memoryOutboxModel) CountByStatus(ctx context.Context) (map[string]int, error) {
+	defer m.s.lock()()
+
+	counts := map[string]int{
+		EmailStatusPending: 0,
+		EmailStatusSent:    0,
+		EmailStatusDead:    0,
+	}
+
+	for _, email := range m.s.data.emails {
+		counts[email.Status]++
+	}
+
+	return counts, nil
+}
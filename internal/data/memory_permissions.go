@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"sort"
+)
+
+type memoryPermissionModel struct {
+	s *memoryStore
+}
+
+func (m memoryPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	defer m.s.lock()()
+
+	var permissions Permissions
+
+	for _, permission := range m.s.data.permissions {
+		if m.s.data.usersPermissions[[2]int64{userID, permission.ID}] && !permissions.Include(permission.Code) {
+			permissions = append(permissions, permission.Code)
+		}
+	}
+
+	for roleID, role := range m.s.data.roles {
+		if !m.s.data.usersRoles[[2]int64{userID, roleID}] {
+			continue
+		}
+
+		for _, code := range role.permissions {
+			if !permissions.Include(code) {
+				permissions = append(permissions, code)
+			}
+		}
+	}
+
+	slices.Sort(permissions)
+
+	return permissions, nil
+}
+
+func (m memoryPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	defer m.s.lock()()
+
+	// Like the SQL model, unknown codes are skipped.
+	for _, permission := range m.s.data.permissions {
+		if slices.Contains(codes, permission.Code) {
+			m.s.data.usersPermissions[[2]int64{userID, permission.ID}] = true
+		}
+	}
+
+	return nil
+}
+
+func (m memoryPermissionModel) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	defer m.s.lock()()
+
+	for _, permission := range m.s.data.permissions {
+		if slices.Contains(codes, permission.Code) {
+			delete(m.s.data.usersPermissions, [2]int64{userID, permission.ID})
+		}
+	}
+
+	return nil
+}
+
+func (m memoryPermissionModel) GetAll(ctx context.Context) ([]*Permission, error) {
+	defer m.s.lock()()
+
+	permissions := []*Permission{}
+
+	for _, permission := range m.s.data.permissions {
+		permission := permission
+		permissions = append(permissions, &permission)
+	}
+
+	sort.Slice(permissions, func(i, j int) bool {
+		return permissions[i].Code < permissions[j].Code
+	})
+
+	return permissions, nil
+}
+
+func (m memoryPermissionModel) Insert(ctx context.Context, permission *Permission) error {
+	defer m.s.lock()()
+
+	for _, existing := range m.s.data.permissions {
+		if existing.Code == permission.Code {
+			return ErrDuplicatePermission
+		}
+	}
+
+	permission.ID = m.s.data.nextID("permissions")
+	m.s.data.permissions[permission.ID] = *permission
+
+	for id, role := range m.s.data.roles {
+		if role.name == "admin" {
+			// Stored roles are never modified in place, so the permissions are copied.
+			role.permissions = append(slices.Clone(role.permissions), permission.Code)
+			m.s.data.roles[id] = role
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type memoryMovieRevisionModel struct {
+	s *memoryStore
+}
+
+func (m memoryMovieRevisionModel) Insert(ctx context.Context, revision *MovieRevision) error {
+	defer m.s.lock()()
+
+	revision.ID = m.s.data.nextID("movie_revisions")
+	revision.CreatedAt = time.Now().Truncate(time.Second)
+
+	m.s.data.movieRevisions[revision.ID] = copyMovieRevision(*revision)
+
+	return nil
+}
+
+func (m memoryMovieRevisionModel) Get(ctx context.Context, movieID int64, version int32) (*MovieRevision, error) {
+	defer m.s.lock()()
+
+	var found *MovieRevision
+
+	for _, revision := range m.s.data.movieRevisions {
+		if revision.Movie.ID != movieID || revision.Movie.Version != version || revision.Operation == RevisionDelete {
+			continue
+		}
+
+		if found == nil || revision.ID > found.ID {
+			revision := copyMovieRevision(revision)
+			found = &revision
+		}
+	}
+
+	if found == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return found, nil
+}
+
+func (m memoryMovieRevisionModel) GetAllForMovie(ctx context.Context, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	defer m.s.lock()()
+
+	matches := []*MovieRevision{}
+
+	for _, revision := range m.s.data.movieRevisions {
+		if revision.Movie.ID == movieID {
+			revision := copyMovieRevision(revision)
+			matches = append(matches, &revision)
+		}
+	}
+
+	descending := filters.sortDirection() == "DESC"
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if descending {
+			a, b = b, a
+		}
+
+		if a.Movie.Version != b.Movie.Version {
+			return a.Movie.Version < b.Movie.Version
+		}
+
+		return a.ID < b.ID
+	})
+
+	totalRecords := len(matches)
+	start := min(filters.offset(), totalRecords)
+	end := min(start+filters.limit(), totalRecords)
+
+	// Like the SQL model, an out of range page yields no metadata since no rows carry the total count.
+	metadata := Metadata{}
+	if start < end {
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	}
+
+	return matches[start:end], metadata, nil
+}
+
+func copyMovieRevision(revision MovieRevision) MovieRevision {
+	revision.Movie = copyMovie(revision.Movie)
+
+	if revision.UserID != nil {
+		userID := *revision.UserID
+		revision.UserID = &userID
+	}
+
+	return revision
+}
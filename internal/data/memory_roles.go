@@ -0,0 +1,82 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"sort"
+)
+
+// Role as stored in the roles table, together with the codes of its permissions.
+type memoryRole struct {
+	name        string
+	permissions []string
+}
+
+type memoryRoleModel struct {
+	s *memoryStore
+}
+
+func (m memoryRoleModel) GetAll(ctx context.Context) ([]*Role, error) {
+	defer m.s.lock()()
+
+	roles := []*Role{}
+
+	for id, role := range m.s.data.roles {
+		permissions := slices.Clone(role.permissions)
+		slices.Sort(permissions)
+
+		roles = append(roles, &Role{ID: id, Name: role.name, Permissions: append(Permissions{}, permissions...)})
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].ID < roles[j].ID
+	})
+
+	return roles, nil
+}
+
+func (m memoryRoleModel) GetAllForUser(ctx context.Context, userID int64) (Roles, error) {
+	defer m.s.lock()()
+
+	ids := []int64{}
+
+	for id := range m.s.data.roles {
+		if m.s.data.usersRoles[[2]int64{userID, id}] {
+			ids = append(ids, id)
+		}
+	}
+
+	slices.Sort(ids)
+
+	roles := Roles{}
+	for _, id := range ids {
+		roles = append(roles, m.s.data.roles[id].name)
+	}
+
+	return roles, nil
+}
+
+func (m memoryRoleModel) AddForUser(ctx context.Context, userID int64, names ...string) error {
+	defer m.s.lock()()
+
+	// Like the SQL model, unknown roles are skipped.
+	for id, role := range m.s.data.roles {
+		if slices.Contains(names, role.name) {
+			m.s.data.usersRoles[[2]int64{userID, id}] = true
+		}
+	}
+
+	return nil
+}
+
+func (m memoryRoleModel) RemoveForUser(ctx context.Context, userID int64, names ...string) error {
+	defer m.s.lock()()
+
+	for id, role := range m.s.data.roles {
+		if slices.Contains(names, role.name) {
+			delete(m.s.data.usersRoles, [2]int64{userID, id})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"sort"
+	"time"
+)
+
+// Token as stored in the tokens table, which additionally tracks when it was last used.
+type memoryToken struct {
+	Token
+	lastUsedAt *time.Time
+}
+
+type memoryTokenModel struct {
+	s *memoryStore
+}
+
+func (m memoryTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m memoryTokenModel) NewInFamily(ctx context.Context, userID int64, ttl time.Duration, scope string, family []byte, ip, userAgent string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Family = family
+	token.IP = ip
+	token.UserAgent = userAgent
+
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m memoryTokenModel) Insert(ctx context.Context, token *Token) error {
+	defer m.s.lock()()
+
+	token.ID = m.s.data.nextID("tokens")
+	token.CreatedAt = time.Now().Truncate(time.Second)
+
+	stored := *token
+	stored.Plaintext = ""
+
+	m.s.data.tokens[string(token.Hash)] = memoryToken{Token: stored}
+
+	return nil
+}
+
+func (m memoryTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	defer m.s.lock()()
+
+	m.s.data.deleteTokens(func(token memoryToken) bool {
+		return token.Scope == scope && token.UserId == userID
+	})
+
+	return nil
+}
+
+func (m memoryTokenModel) GetByPlaintext(ctx context.Context, scope, tokenPlaintext string) (*Token, error) {
+	defer m.s.lock()()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	stored, ok := m.s.data.tokens[string(tokenHash[:])]
+	if !ok || stored.Scope != scope || !stored.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	token := stored.Token
+	token.Plaintext = tokenPlaintext
+
+	return &token, nil
+}
+
+func (m memoryTokenModel) MarkUsed(ctx context.Context, token *Token) error {
+	defer m.s.lock()()
+
+	stored, ok := m.s.data.tokens[string(token.Hash)]
+	if !ok || stored.Used {
+		return ErrTokenReused
+	}
+
+	stored.Used = true
+	m.s.data.tokens[string(token.Hash)] = stored
+
+	token.Used = true
+
+	return nil
+}
+
+func (m memoryTokenModel) Delete(ctx context.Context, token *Token) error {
+	defer m.s.lock()()
+
+	delete(m.s.data.tokens, string(token.Hash))
+
+	return nil
+}
+
+func (m memoryTokenModel) DeleteAllForFamily(ctx context.Context, scope string, family []byte) error {
+	defer m.s.lock()()
+
+	m.s.data.deleteTokens(func(token memoryToken) bool {
+		return token.Scope == scope && sameFamily(token.Family, family)
+	})
+
+	return nil
+}
+
+func (m memoryTokenModel) DeleteFamily(ctx context.Context, family []byte) error {
+	defer m.s.lock()()
+
+	m.s.data.deleteTokens(func(token memoryToken) bool {
+		return sameFamily(token.Family, family)
+	})
+
+	return nil
+}
+
+func (m memoryTokenModel) Touch(ctx context.Context, tokenPlaintext string) error {
+	defer m.s.lock()()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	stored, ok := m.s.data.tokens[string(tokenHash[:])]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+
+	if stored.lastUsedAt == nil || stored.lastUsedAt.Before(now.Add(-time.Minute)) {
+		stored.lastUsedAt = &now
+		m.s.data.tokens[string(tokenHash[:])] = stored
+	}
+
+	return nil
+}
+
+func (m memoryTokenModel) GetAllSessionsForUser(ctx context.Context, userID int64, currentTokenPlaintext string) ([]*Session, error) {
+	defer m.s.lock()()
+
+	currentHash := sha256.Sum256([]byte(currentTokenPlaintext))
+	now := time.Now()
+
+	sessions := []*Session{}
+
+	for _, token := range m.s.data.tokens {
+		if token.UserId != userID || token.Scope != ScopeAuthentication || !token.Expiry.After(now) {
+			continue
+		}
+
+		sessions = append(sessions, &Session{
+			ID:         token.ID,
+			CreatedAt:  token.CreatedAt,
+			LastUsedAt: token.lastUsedAt,
+			Expiry:     token.Expiry,
+			IP:         token.IP,
+			UserAgent:  token.UserAgent,
+			Current:    bytes.Equal(token.Hash, currentHash[:]),
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+		}
+
+		return sessions[i].ID > sessions[j].ID
+	})
+
+	return sessions, nil
+}
+
+func (m memoryTokenModel) DeleteSessionForUser(ctx context.Context, userID, sessionID int64) error {
+	defer m.s.lock()()
+
+	var session *memoryToken
+
+	for _, token := range m.s.data.tokens {
+		if token.ID == sessionID && token.UserId == userID && token.Scope == ScopeAuthentication {
+			session = &token
+			break
+		}
+	}
+
+	if session == nil {
+		return ErrRecordNotFound
+	}
+
+	m.s.data.deleteTokens(func(token memoryToken) bool {
+		return token.UserId == userID && (token.ID == session.ID || sameFamily(token.Family, session.Family))
+	})
+
+	return nil
+}
+
+func (m memoryTokenModel) DeleteExpired(ctx context.Context) (int64, error) {
+	defer m.s.lock()()
+
+	now := time.Now()
+
+	deleted := m.s.data.deleteTokens(func(token memoryToken) bool {
+		return !token.Expiry.After(now)
+	})
+
+	return deleted, nil
+}
+
+// Deletes all tokens matching the predicate, returning the number of deleted tokens.
+func (d *memoryData) deleteTokens(match func(token memoryToken) bool) int64 {
+	var deleted int64
+
+	for hash, token := range d.tokens {
+		if match(token) {
+			delete(d.tokens, hash)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// Mirrors the family = $1 comparison, where tokens without a family (NULL) never match.
+func sameFamily(a, b []byte) bool {
+	return a != nil && b != nil && bytes.Equal(a, b)
+}
@@ -0,0 +1,127 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"sort"
+	"strings"
+	"time"
+)
+
+type memoryUserModel struct {
+	s *memoryStore
+}
+
+func (m memoryUserModel) Insert(ctx context.Context, user *User) error {
+	defer m.s.lock()()
+
+	if m.s.data.emailTaken(user.Email, 0) {
+		return ErrDuplicateEmail
+	}
+
+	user.ID = m.s.data.nextID("users")
+	user.CreatedAt = time.Now().Truncate(time.Second)
+	user.Version = 1
+
+	m.s.data.users[user.ID] = storedUser(user)
+
+	return nil
+}
+
+func (m memoryUserModel) Get(ctx context.Context, id int64) (*User, error) {
+	defer m.s.lock()()
+
+	user, ok := m.s.data.users[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return &user, nil
+}
+
+func (m memoryUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	defer m.s.lock()()
+
+	for _, user := range m.s.data.users {
+		// The email column is case-insensitive.
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m memoryUserModel) Update(ctx context.Context, user *User) error {
+	defer m.s.lock()()
+
+	stored, ok := m.s.data.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	if m.s.data.emailTaken(user.Email, user.ID) {
+		return ErrDuplicateEmail
+	}
+
+	user.Version++
+	user.CreatedAt = stored.CreatedAt
+
+	m.s.data.users[user.ID] = storedUser(user)
+
+	return nil
+}
+
+func (m memoryUserModel) GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error) {
+	defer m.s.lock()()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	token, ok := m.s.data.tokens[string(tokenHash[:])]
+	if !ok || token.Scope != scope || !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	user, ok := m.s.data.users[token.UserId]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return &user, nil
+}
+
+func (m memoryUserModel) GetAll(ctx context.Context) ([]*User, error) {
+	defer m.s.lock()()
+
+	users := []*User{}
+
+	for _, user := range m.s.data.users {
+		user := user
+		users = append(users, &user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	return users, nil
+}
+
+// Reports whether another user than the one with the given id already uses the email address.
+func (d *memoryData) emailTaken(email string, id int64) bool {
+	for _, user := range d.users {
+		if user.ID != id && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the user as it is stored, i.e. without the plaintext password which isn't persisted.
+func storedUser(user *User) User {
+	stored := *user
+	stored.Password.plaintext = nil
+
+	return stored
+}
@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -10,20 +12,166 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// Common interface of *sql.DB and *sql.Tx, which allows models to run their queries inside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Repository interfaces implemented by the PostgreSQL models and their in-memory counterparts.
+type (
+	MovieRepository interface {
+		Insert(ctx context.Context, movie *Movie) error
+		Get(ctx context.Context, id int64) (*Movie, error)
+		Update(ctx context.Context, movie *Movie) error
+		Delete(ctx context.Context, id int64, version int32) error
+		GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+		GetAllDeleted(ctx context.Context, filters Filters) ([]*Movie, Metadata, error)
+		Restore(ctx context.Context, id int64) (*Movie, error)
+		PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	}
+
+	MovieRevisionRepository interface {
+		Insert(ctx context.Context, revision *MovieRevision) error
+		Get(ctx context.Context, movieID int64, version int32) (*MovieRevision, error)
+		GetAllForMovie(ctx context.Context, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error)
+	}
+
+	UserRepository interface {
+		Insert(ctx context.Context, user *User) error
+		Get(ctx context.Context, id int64) (*User, error)
+		GetByEmail(ctx context.Context, email string) (*User, error)
+		Update(ctx context.Context, user *User) error
+		GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error)
+		GetAll(ctx context.Context) ([]*User, error)
+	}
+
+	TokenRepository interface {
+		New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+		NewInFamily(ctx context.Context, userID int64, ttl time.Duration, scope string, family []byte, ip, userAgent string) (*Token, error)
+		Insert(ctx context.Context, token *Token) error
+		DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+		GetByPlaintext(ctx context.Context, scope, tokenPlaintext string) (*Token, error)
+		MarkUsed(ctx context.Context, token *Token) error
+		Delete(ctx context.Context, token *Token) error
+		DeleteAllForFamily(ctx context.Context, scope string, family []byte) error
+		DeleteFamily(ctx context.Context, family []byte) error
+		Touch(ctx context.Context, tokenPlaintext string) error
+		GetAllSessionsForUser(ctx context.Context, userID int64, currentTokenPlaintext string) ([]*Session, error)
+		DeleteSessionForUser(ctx context.Context, userID, sessionID int64) error
+		DeleteExpired(ctx context.Context) (int64, error)
+	}
+
+	PermissionRepository interface {
+		GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+		AddForUser(ctx context.Context, userID int64, codes ...string) error
+		RemoveForUser(ctx context.Context, userID int64, codes ...string) error
+		GetAll(ctx context.Context) ([]*Permission, error)
+		Insert(ctx context.Context, permission *Permission) error
+	}
+
+	RoleRepository interface {
+		GetAll(ctx context.Context) ([]*Role, error)
+		GetAllForUser(ctx context.Context, userID int64) (Roles, error)
+		AddForUser(ctx context.Context, userID int64, names ...string) error
+		RemoveForUser(ctx context.Context, userID int64, names ...string) error
+	}
+
+	OutboxRepository interface {
+		Insert(ctx context.Context, email *Email) error
+		Claim(ctx context.Context, limit int, lease time.Duration) ([]*Email, error)
+		MarkSent(ctx context.Context, email *Email) error
+		MarkFailed(ctx context.Context, email *Email, deliveryErr error, nextAttempt time.Time, dead bool) error
+		PurgeDead(ctx context.Context, before time.Time) (int64, error)
+		PurgeSent(ctx context.Context, before time.Time) (int64, error)
+		CountByStatus(ctx context.Context) (map[string]int, error)
+	}
+)
+
 // Holds all application db models.
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Movies         MovieRepository
+	MovieRevisions MovieRevisionRepository
+	Users          UserRepository
+	Tokens         TokenRepository
+	Permissions    PermissionRepository
+	Roles          RoleRepository
+	Outbox         OutboxRepository
+
+	// Backend the models are stored in, which runs transactions and health checks.
+	store store
+}
+
+type store interface {
+	transaction(ctx context.Context, m Models, fn func(tx Models) error) error
+	ping(ctx context.Context) error
 }
 
 // Simple helper to initialize all db models with the provided db connection.
-func NewModels(db *sql.DB) Models {
+//
+// The query timeout bounds every single query, in addition to the deadline of the context passed by the caller.
+func NewModels(db *sql.DB, queryTimeout time.Duration) Models {
+	return newModels(db, sqlStore{db: db, queryTimeout: queryTimeout}, queryTimeout)
+}
+
+func newModels(db DBTX, s store, queryTimeout time.Duration) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:         MovieModel{DB: db, timeout: queryTimeout},
+		MovieRevisions: MovieRevisionModel{DB: db, timeout: queryTimeout},
+		Users:          UserModel{DB: db, timeout: queryTimeout},
+		Tokens:         TokenModel{DB: db, timeout: queryTimeout},
+		Permissions:    PermissionModel{DB: db, timeout: queryTimeout},
+		Roles:          RoleModel{DB: db, timeout: queryTimeout},
+		Outbox:         OutboxModel{DB: db, timeout: queryTimeout},
+		store:          s,
+	}
+}
+
+// Verifies that the database is reachable, used by the readiness check.
+func (m Models) Ping(ctx context.Context) error {
+	return m.store.ping(ctx)
+}
+
+// Runs fn with a set of models whose queries all belong to the same database transaction.
+//
+// The transaction is committed if fn returns nil and rolled back otherwise. Calling Transaction
+// on models that are already part of a transaction runs fn within that outer transaction.
+func (m Models) Transaction(ctx context.Context, fn func(tx Models) error) error {
+	return m.store.transaction(ctx, m, fn)
+}
+
+// Store backed by a PostgreSQL connection pool, the pool is nil for models that are already part of a transaction.
+type sqlStore struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func (s sqlStore) transaction(ctx context.Context, m Models, fn func(tx Models) error) error {
+	if s.db == nil {
+		return fn(m)
 	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	err = fn(newModels(tx, sqlStore{queryTimeout: s.queryTimeout}, s.queryTimeout))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s sqlStore) ping(ctx context.Context) error {
+	if s.db == nil {
+		return errors.New("models are part of a transaction")
+	}
+
+	return s.db.PingContext(ctx)
 }
@@ -0,0 +1,526 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/ricci2511/greenlight-api/migrations"
+)
+
+// Returns the models every test runs against: the in-memory models, and the PostgreSQL models
+// if GREENLIGHT_TEST_DB_DSN is set. That database is wiped and migrated from scratch.
+func newTestModels(t *testing.T) map[string]Models {
+	t.Helper()
+
+	models := map[string]Models{"memory": NewMemoryModels()}
+
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		return models
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	resetSchema(t, db)
+
+	models["postgres"] = NewModels(db, 5*time.Second)
+
+	return models
+}
+
+// Rolls back all embedded migrations and applies them again, so every test starts from the seeded schema.
+func resetSchema(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for _, step := range []func() error{m.Down, m.Up} {
+		err = step()
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Runs the test against every store returned by newTestModels().
+func forEachStore(t *testing.T, test func(t *testing.T, models Models)) {
+	for name, models := range newTestModels(t) {
+		models := models
+
+		t.Run(name, func(t *testing.T) {
+			test(t, models)
+		})
+	}
+}
+
+func insertTestMovie(t *testing.T, models Models, title string, year int32, runtime Runtime) *Movie {
+	t.Helper()
+
+	movie := &Movie{Title: title, Year: year, Runtime: runtime, Genres: []string{"drama"}}
+
+	err := models.Movies.Insert(context.Background(), movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return movie
+}
+
+func insertTestUser(t *testing.T, models Models, email string) *User {
+	t.Helper()
+
+	user := &User{Name: "Alice", Email: email, Activated: true}
+
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+// Returns the titles of the movies in order.
+func movieTitles(movies []*Movie) []string {
+	titles := []string{}
+
+	for _, movie := range movies {
+		titles = append(titles, movie.Title)
+	}
+
+	return titles
+}
+
+func TestMovieVersionConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		stale   bool
+		change  func(ctx context.Context, models Models, movie *Movie) error
+		wantErr error
+	}{
+		{
+			name:   "update with current version",
+			change: func(ctx context.Context, models Models, movie *Movie) error { return models.Movies.Update(ctx, movie) },
+		},
+		{
+			name:    "update with stale version",
+			stale:   true,
+			change:  func(ctx context.Context, models Models, movie *Movie) error { return models.Movies.Update(ctx, movie) },
+			wantErr: ErrEditConflict,
+		},
+		{
+			name: "delete with current version",
+			change: func(ctx context.Context, models Models, movie *Movie) error {
+				return models.Movies.Delete(ctx, movie.ID, movie.Version)
+			},
+		},
+		{
+			name:  "delete with stale version",
+			stale: true,
+			change: func(ctx context.Context, models Models, movie *Movie) error {
+				return models.Movies.Delete(ctx, movie.ID, movie.Version)
+			},
+			wantErr: ErrEditConflict,
+		},
+	}
+
+	forEachStore(t, func(t *testing.T, models Models) {
+		ctx := context.Background()
+
+		for _, tt := range tests {
+			movie := insertTestMovie(t, models, tt.name, 2000, 100)
+			version := movie.Version
+
+			if tt.stale {
+				// Another client changes the movie after it was read.
+				current := *movie
+				current.Title += " (edited)"
+
+				err := models.Movies.Update(ctx, &current)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := tt.change(ctx, models, movie)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: got error %v; want %v", tt.name, err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil && movie.Version != version {
+				t.Errorf("%s: got version %d after a conflict; want %d", tt.name, movie.Version, version)
+			}
+		}
+	})
+}
+
+func TestUserDuplicateEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		wantErr error
+	}{
+		{name: "same email", email: "alice@example.com", wantErr: ErrDuplicateEmail},
+		{name: "same email in other case", email: "ALICE@example.com", wantErr: ErrDuplicateEmail},
+		{name: "other email", email: "bob@example.com"},
+	}
+
+	forEachStore(t, func(t *testing.T, models Models) {
+		ctx := context.Background()
+
+		insertTestUser(t, models, "alice@example.com")
+
+		for _, tt := range tests {
+			user := &User{Name: "Someone", Email: tt.email}
+			user.Password.hash = []byte("hash")
+
+			err := models.Users.Insert(ctx, user)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: got error %v; want %v", tt.name, err, tt.wantErr)
+			}
+		}
+	})
+}
+
+func TestTokenExpiryAndUsedFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		wantErr error
+	}{
+		{name: "valid token", ttl: time.Hour},
+		{name: "expired token", ttl: -time.Minute, wantErr: ErrRecordNotFound},
+	}
+
+	forEachStore(t, func(t *testing.T, models Models) {
+		ctx := context.Background()
+
+		user := insertTestUser(t, models, "alice@example.com")
+
+		for _, tt := range tests {
+			token, err := models.Tokens.New(ctx, user.ID, tt.ttl, ScopeRefresh)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = models.Tokens.GetByPlaintext(ctx, ScopeRefresh, token.Plaintext)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: GetByPlaintext got error %v; want %v", tt.name, err, tt.wantErr)
+			}
+
+			_, err = models.Users.GetForToken(ctx, ScopeRefresh, token.Plaintext)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: GetForToken got error %v; want %v", tt.name, err, tt.wantErr)
+			}
+
+			// Tokens are only found in the scope they were created for.
+			_, err = models.Tokens.GetByPlaintext(ctx, ScopeAuthentication, token.Plaintext)
+			if !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("%s: GetByPlaintext in other scope got error %v; want %v", tt.name, err, ErrRecordNotFound)
+			}
+		}
+
+		token, err := models.Tokens.New(ctx, user.ID, time.Hour, ScopeRefresh)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, wantErr := range []error{nil, ErrTokenReused} {
+			stored, err := models.Tokens.GetByPlaintext(ctx, ScopeRefresh, token.Plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stored.Used != (i > 0) {
+				t.Errorf("got used %t before exchange %d; want %t", stored.Used, i+1, i > 0)
+			}
+
+			err = models.Tokens.MarkUsed(ctx, stored)
+			if !errors.Is(err, wantErr) {
+				t.Errorf("exchange %d: got error %v; want %v", i+1, err, wantErr)
+			}
+		}
+	})
+}
+
+func TestMovieTitleSearch(t *testing.T) {
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{title: "", want: []string{"The Matrix", "The Matrix Reloaded", "Moana", "Black Panther"}},
+		{title: "matrix", want: []string{"The Matrix", "The Matrix Reloaded"}},
+		{title: "MATRIX reloaded", want: []string{"The Matrix Reloaded"}},
+		{title: "reloaded matrix", want: []string{"The Matrix Reloaded"}},
+		{title: "panther!", want: []string{"Black Panther"}},
+		{title: "matri", want: []string{}},
+		{title: "alien", want: []string{}},
+	}
+
+	forEachStore(t, func(t *testing.T, models Models) {
+		for _, title := range []string{"The Matrix", "The Matrix Reloaded", "Moana", "Black Panther"} {
+			insertTestMovie(t, models, title, 2000, 100)
+		}
+
+		filters := Filters{Page: 1, PageSize: 20, Sort: "id", SortSafeList: []string{"id"}}
+
+		for _, tt := range tests {
+			movies, _, err := models.Movies.GetAll(context.Background(), tt.title, []string{}, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := movieTitles(movies); !slices.Equal(got, tt.want) {
+				t.Errorf("title %q: got %q; want %q", tt.title, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestMovieCursorPaging(t *testing.T) {
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{sort: "id", want: []string{"a", "b", "c", "d", "e"}},
+		{sort: "-id", want: []string{"e", "d", "c", "b", "a"}},
+		// Ties on the sort column are broken by the id in ascending order.
+		{sort: "year", want: []string{"c", "a", "d", "b", "e"}},
+		{sort: "-runtime", want: []string{"b", "e", "a", "c", "d"}},
+		{sort: "title", want: []string{"a", "b", "c", "d", "e"}},
+	}
+
+	forEachStore(t, func(t *testing.T, models Models) {
+		movies := []struct {
+			title   string
+			year    int32
+			runtime Runtime
+		}{
+			{"a", 2001, 100},
+			{"b", 2005, 150},
+			{"c", 1999, 90},
+			{"d", 2001, 90},
+			{"e", 2010, 150},
+		}
+
+		for _, movie := range movies {
+			insertTestMovie(t, models, movie.title, movie.year, movie.runtime)
+		}
+
+		for _, tt := range tests {
+			filters := Filters{
+				PageSize:     2,
+				Sort:         tt.sort,
+				SortSafeList: []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"},
+				UseCursor:    true,
+			}
+
+			got := []string{}
+
+			for pages := 0; ; pages++ {
+				if pages == 3 {
+					t.Fatalf("sort %q: more pages than expected", tt.sort)
+				}
+
+				page, metadata, err := models.Movies.GetAll(context.Background(), "", []string{}, filters)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got = append(got, movieTitles(page)...)
+
+				if metadata.NextCursor == "" {
+					break
+				}
+
+				filters.Cursor = metadata.NextCursor
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sort %q: got %q; want %q", tt.sort, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestMovieSoftDelete(t *testing.T) {
+	forEachStore(t, func(t *testing.T, models Models) {
+		ctx := context.Background()
+
+		kept := insertTestMovie(t, models, "Kept", 2000, 100)
+		deleted := insertTestMovie(t, models, "Deleted", 2000, 100)
+
+		err := models.Movies.Delete(ctx, deleted.ID, deleted.Version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filters := Filters{Page: 1, PageSize: 20, Sort: "id", SortSafeList: []string{"id"}}
+
+		tests := []struct {
+			name string
+			run  func() error
+			want error
+		}{
+			{
+				name: "get",
+				run: func() error {
+					_, err := models.Movies.Get(ctx, deleted.ID)
+					return err
+				},
+				want: ErrRecordNotFound,
+			},
+			{
+				name: "update",
+				run:  func() error { return models.Movies.Update(ctx, deleted) },
+				want: ErrEditConflict,
+			},
+			{
+				name: "delete again",
+				run:  func() error { return models.Movies.Delete(ctx, deleted.ID, deleted.Version) },
+				want: ErrEditConflict,
+			},
+		}
+
+		for _, tt := range tests {
+			if err := tt.run(); !errors.Is(err, tt.want) {
+				t.Errorf("%s: got error %v; want %v", tt.name, err, tt.want)
+			}
+		}
+
+		movies, _, err := models.Movies.GetAll(ctx, "", []string{}, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := movieTitles(movies); !slices.Equal(got, []string{kept.Title}) {
+			t.Errorf("GetAll: got %q; want %q", got, []string{kept.Title})
+		}
+
+		trash, _, err := models.Movies.GetAllDeleted(ctx, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := movieTitles(trash); !slices.Equal(got, []string{deleted.Title}) {
+			t.Errorf("GetAllDeleted: got %q; want %q", got, []string{deleted.Title})
+		}
+
+		restored, err := models.Movies.Restore(ctx, deleted.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Clients holding the version from before the delete must not be able to change the restored movie.
+		if restored.Version != deleted.Version+1 {
+			t.Errorf("Restore: got version %d; want %d", restored.Version, deleted.Version+1)
+		}
+
+		_, err = models.Movies.Restore(ctx, deleted.ID)
+		if !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("Restore again: got error %v; want %v", err, ErrRecordNotFound)
+		}
+	})
+}
+
+func TestOutboxPurge(t *testing.T) {
+	forEachStore(t, func(t *testing.T, models Models) {
+		ctx := context.Background()
+
+		emails := map[string]*Email{}
+
+		for _, status := range []string{EmailStatusPending, EmailStatusSent, EmailStatusDead} {
+			email := &Email{Recipient: status + "@example.com", Template: "user_welcome.html", Data: map[string]any{}}
+
+			err := models.Outbox.Insert(ctx, email)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			emails[status] = email
+		}
+
+		err := models.Outbox.MarkSent(ctx, emails[EmailStatusSent])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = models.Outbox.MarkFailed(ctx, emails[EmailStatusDead], errors.New("mailbox full"), time.Now(), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name   string
+			before time.Time
+			want   map[string]int
+		}{
+			{
+				name:   "within the retention",
+				before: time.Now().Add(-time.Hour),
+				want:   map[string]int{EmailStatusPending: 1, EmailStatusSent: 1, EmailStatusDead: 1},
+			},
+			{
+				name:   "past the retention",
+				before: time.Now().Add(time.Minute),
+				want:   map[string]int{EmailStatusPending: 1, EmailStatusSent: 0, EmailStatusDead: 0},
+			},
+		}
+
+		for _, tt := range tests {
+			for _, purge := range []func(context.Context, time.Time) (int64, error){models.Outbox.PurgeSent, models.Outbox.PurgeDead} {
+				_, err := purge(ctx, tt.before)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			counts, err := models.Outbox.CountByStatus(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !maps.Equal(counts, tt.want) {
+				t.Errorf("%s: got counts %v; want %v", tt.name, counts, tt.want)
+			}
+		}
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/lib/pq"
@@ -13,20 +14,22 @@ import (
 
 // Represents a movie table in the database.
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID        int64      `json:"id"`
+	CreatedAt time.Time  `json:"-"`
+	Title     string     `json:"title"`
+	Year      int32      `json:"year,omitempty"`
+	Runtime   Runtime    `json:"runtime,omitempty"`
+	Genres    []string   `json:"genres,omitempty"`
+	Version   int32      `json:"version"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"` // Set while the movie is in the trash
 }
 
 type MovieModel struct {
-	DB *sql.DB
+	DB      DBTX
+	timeout time.Duration
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
+func (m MovieModel) Insert(ctx context.Context, movie *Movie) error {
 	query := `
 		INSERT INTO movies (title, year, runtime, genres)
 		VALUES ($1, $2, $3, $4)
@@ -34,15 +37,14 @@ func (m MovieModel) Insert(movie *Movie) error {
 
 	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
 
-	// Set a 3 seconds timeout for the query.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	ctx, done := startQuery(ctx, m.timeout, "MovieModel.Insert", query)
+	defer done()
 
 	// Mutate the passed movie struct with the generated id, created_at and version values.
 	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
 }
 
-func (m MovieModel) Get(id int64) (*Movie, error) {
+func (m MovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
@@ -50,13 +52,12 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	query := `
 		SELECT id, created_at, title, year, runtime, genres, version
 		FROM movies
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	var movie Movie
 
-	// Set a 3 seconds timeout for the query.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	ctx, done := startQuery(ctx, m.timeout, "MovieModel.Get", query)
+	defer done()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&movie.ID,
@@ -79,18 +80,17 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+func (m MovieModel) Update(ctx context.Context, movie *Movie) error {
 	query := `
 		UPDATE movies
 		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		WHERE id = $5 AND version = $6 AND deleted_at IS NULL
 		RETURNING version`
 
 	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version}
 
-	// Set a 3 seconds timeout for the query.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	ctx, done := startQuery(ctx, m.timeout, "MovieModel.Update", query)
+	defer done()
 
 	// Mutate the passed movie struct with the new version value.
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
@@ -105,20 +105,22 @@ func (m MovieModel) Update(movie *Movie) error {
 	return nil
 }
 
-func (m MovieModel) Delete(id int64) error {
+// Moves the movie to the trash, as long as it still has the expected version.
+func (m MovieModel) Delete(ctx context.Context, id int64, version int32) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
+	// Deleted movies are moved to the trash, from where they can be restored until they are purged.
 	query := `
-		DELETE FROM movies
-		WHERE id = $1`
+		UPDATE movies
+		SET deleted_at = NOW()
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
 
-	// Set a 3 seconds timeout for the query.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	ctx, done := startQuery(ctx, m.timeout, "MovieModel.Delete", query)
+	defer done()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -128,26 +130,31 @@ func (m MovieModel) Delete(id int64) error {
 		return nil
 	}
 
-	// Means that the movie with the given id doesn't exist.
+	// Means that the movie was changed or deleted since it was fetched, same as in Update.
 	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		return ErrEditConflict
 	}
 
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m MovieModel) GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	if filters.UseCursor {
+		return m.getAllAfterCursor(ctx, title, genres, filters)
+	}
+
 	// Title filter uses psql's full-text search.
 	query := fmt.Sprintf(`
 		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
 		FROM movies
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		WHERE deleted_at IS NULL
+		AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (genres @> $2 OR $2 = '{}')
 		ORDER BY %s %s, id ASC
 		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	ctx, done := startQuery(ctx, m.timeout, "MovieModel.GetAll", query)
+	defer done()
 
 	// All arguments for the placeholder parameters.
 	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
@@ -193,6 +200,210 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	return movies, metadata, nil
 }
 
+// Keyset pagination variant of GetAll(), which seeks past the cursor position instead of using OFFSET.
+//
+// This keeps deep pages fast and stable when movies are inserted, at the cost of not knowing the total records.
+func (m MovieModel) getAllAfterCursor(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	c, err := filters.cursor()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// Fetch one extra record to find out whether there is a next page.
+	args := []any{title, pq.Array(genres), filters.limit() + 1}
+
+	// Without a cursor, pagination starts from the first record.
+	condition := "TRUE"
+	if c != nil {
+		condition = filters.cursorCondition(4)
+		args = append(args, c.Value, c.ID)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at, title, year, runtime, genres, version
+		FROM movies
+		WHERE deleted_at IS NULL
+		AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (genres @> $2 OR $2 = '{}')
+		AND %s
+		ORDER BY %s %s, id ASC
+		LIMIT $3`, condition, filters.sortColumn(), filters.sortDirection())
+
+	ctx, done := startQuery(ctx, m.timeout, "MovieModel.GetAll", query)
+	defer done()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+
+	// Drop the extra record and point the next cursor at the last movie of this page.
+	if len(movies) > filters.PageSize {
+		movies = movies[:filters.PageSize]
+		last := movies[len(movies)-1]
+
+		metadata.NextCursor = cursor{
+			Sort:  filters.Sort,
+			Value: last.sortValue(filters.sortColumn()),
+			ID:    last.ID,
+		}.encode()
+	}
+
+	return movies, metadata, nil
+}
+
+// Returns a page of the movies in the trash.
+func (m MovieModel) GetAllDeleted(ctx context.Context, filters Filters) ([]*Movie, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at
+		FROM movies
+		WHERE deleted_at IS NOT NULL
+		ORDER BY %s %s, id ASC
+		LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, done := startQuery(ctx, m.timeout, "MovieModel.GetAllDeleted", query)
+	defer done()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+// Takes a movie out of the trash and returns it.
+//
+// The version is incremented, so that requests made with the version from before the delete fail.
+func (m MovieModel) Restore(ctx context.Context, id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, created_at, title, year, runtime, genres, version`
+
+	var movie Movie
+
+	ctx, done := startQuery(ctx, m.timeout, "MovieModel.Restore", query)
+	defer done()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &movie, nil
+}
+
+// Permanently deletes the movies that were moved to the trash before the given time, returning how many were purged.
+func (m MovieModel) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM movies
+		WHERE deleted_at < $1`
+
+	ctx, done := startQuery(ctx, m.timeout, "MovieModel.PurgeDeleted", query)
+	defer done()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Returns the value of the given sort column as a string, used to build pagination cursors.
+func (movie *Movie) sortValue(column string) string {
+	switch column {
+	case "title":
+		return movie.Title
+	case "year":
+		return strconv.Itoa(int(movie.Year))
+	case "runtime":
+		return strconv.Itoa(int(movie.Runtime))
+	default:
+		return strconv.FormatInt(movie.ID, 10)
+	}
+}
+
 func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
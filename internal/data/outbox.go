@@ -0,0 +1,268 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Constants for each delivery status of an outbox email.
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSent    = "sent"
+	EmailStatusDead    = "dead" // Gave up after too many failed delivery attempts
+)
+
+// Represents an email waiting in the outbox to be delivered by a background worker.
+//
+// Emails are written in the same transaction as the records they belong to, so they are never lost.
+type Email struct {
+	ID            int64
+	CreatedAt     time.Time
+	Recipient     string
+	Template      string
+	Data          map[string]any
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	SentAt        *time.Time
+	DeadAt        *time.Time
+}
+
+type OutboxModel struct {
+	DB      DBTX
+	timeout time.Duration
+}
+
+// Adds a new pending email to the outbox, due for immediate delivery.
+func (m OutboxModel) Insert(ctx context.Context, email *Email) error {
+	js, err := json.Marshal(email.Data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO outbox_emails (recipient, template, data)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, status, next_attempt_at`
+
+	ctx, done := startQuery(ctx, m.timeout, "OutboxModel.Insert", query)
+	defer done()
+
+	return m.DB.QueryRowContext(ctx, query, email.Recipient, email.Template, js).Scan(
+		&email.ID,
+		&email.CreatedAt,
+		&email.Status,
+		&email.NextAttemptAt,
+	)
+}
+
+// Claims up to limit pending emails that are due for delivery and counts the upcoming attempt.
+//
+// Claimed emails are leased by pushing their next attempt back by the lease duration, so that
+// other workers skip them and they are retried if this worker dies before reporting the outcome.
+func (m OutboxModel) Claim(ctx context.Context, limit int, lease time.Duration) ([]*Email, error) {
+	query := `
+		UPDATE outbox_emails
+		SET attempts = attempts + 1, next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM outbox_emails
+			WHERE status = $3 AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, created_at, recipient, template, data, status, attempts, next_attempt_at, last_error`
+
+	now := time.Now()
+	args := []any{now, now.Add(lease), EmailStatusPending, limit}
+
+	ctx, done := startQuery(ctx, m.timeout, "OutboxModel.Claim", query)
+	defer done()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []*Email{}
+
+	for rows.Next() {
+		var email Email
+		var js []byte
+
+		err = rows.Scan(
+			&email.ID,
+			&email.CreatedAt,
+			&email.Recipient,
+			&email.Template,
+			&js,
+			&email.Status,
+			&email.Attempts,
+			&email.NextAttemptAt,
+			&email.LastError,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(js, &email.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, &email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// Marks an email as delivered.
+//
+// The template data is cleared, since it usually contains one-time tokens that shouldn't be kept around.
+func (m OutboxModel) MarkSent(ctx context.Context, email *Email) error {
+	query := `
+		UPDATE outbox_emails
+		SET status = $2, sent_at = $3, last_error = '', data = '{}'
+		WHERE id = $1`
+
+	now := time.Now()
+
+	ctx, done := startQuery(ctx, m.timeout, "OutboxModel.MarkSent", query)
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, query, email.ID, EmailStatusSent, now)
+	if err != nil {
+		return err
+	}
+
+	email.Status = EmailStatusSent
+	email.SentAt = &now
+	email.Data = map[string]any{}
+
+	return nil
+}
+
+// Records a failed delivery attempt and schedules the next one.
+//
+// If dead is true, the email is moved to the dead letter status and never retried.
+// Like sent emails, its data is cleared since it may contain tokens.
+func (m OutboxModel) MarkFailed(ctx context.Context, email *Email, deliveryErr error, nextAttempt time.Time, dead bool) error {
+	status := EmailStatusPending
+
+	var deadAt *time.Time
+	if dead {
+		status = EmailStatusDead
+		now := time.Now()
+		deadAt = &now
+	}
+
+	query := `
+		UPDATE outbox_emails
+		SET status = $2, next_attempt_at = $3, last_error = $4, dead_at = $5,
+			data = CASE WHEN $6 THEN '{}' ELSE data END
+		WHERE id = $1`
+
+	args := []any{email.ID, status, nextAttempt, deliveryErr.Error(), deadAt, dead}
+
+	ctx, done := startQuery(ctx, m.timeout, "OutboxModel.MarkFailed", query)
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	email.Status = status
+	email.NextAttemptAt = nextAttempt
+	email.LastError = deliveryErr.Error()
+	email.DeadAt = deadAt
+
+	if dead {
+		email.Data = map[string]any{}
+	}
+
+	return nil
+}
+
+// Permanently deletes dead letters that were given up on before the given time, returning how many were deleted.
+func (m OutboxModel) PurgeDead(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM outbox_emails
+		WHERE status = $1 AND dead_at < $2`
+
+	ctx, done := startQuery(ctx, m.timeout, "OutboxModel.PurgeDead", query)
+	defer done()
+
+	result, err := m.DB.ExecContext(ctx, query, EmailStatusDead, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Permanently deletes emails that were delivered before the given time, returning how many were deleted.
+func (m OutboxModel) PurgeSent(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM outbox_emails
+		WHERE status = $1 AND sent_at < $2`
+
+	ctx, done := startQuery(ctx, m.timeout, "OutboxModel.PurgeSent", query)
+	defer done()
+
+	result, err := m.DB.ExecContext(ctx, query, EmailStatusSent, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Returns the number of outbox emails per delivery status.
+func (m OutboxModel) CountByStatus(ctx context.Context) (map[string]int, error) {
+	query := `
+		SELECT status, count(*)
+		FROM outbox_emails
+		GROUP BY status`
+
+	ctx, done := startQuery(ctx, m.timeout, "OutboxModel.CountByStatus", query)
+	defer done()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Always report every status, even if there are no emails with it.
+	counts := map[string]int{
+		EmailStatusPending: 0,
+		EmailStatusSent:    0,
+		EmailStatusDead:    0,
+	}
+
+	for rows.Next() {
+		var status string
+		var count int
+
+		err = rows.Scan(&status, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[status] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
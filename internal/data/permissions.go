@@ -2,12 +2,26 @@ package data
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"regexp"
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/ricci2511/greenlight-api/internal/validator"
 )
 
+var (
+	ErrDuplicatePermission = errors.New("duplicate permission")
+
+	// Permission codes follow the "<resource>:<action>" format, e.g. movies:read.
+	PermissionCodeRX = regexp.MustCompile("^[a-z][a-z0-9_-]*:[a-z][a-z0-9_-]*$")
+)
+
+type Permission struct {
+	ID   int64  `json:"id"`
+	Code string `json:"code"`
+}
+
 type Permissions []string
 
 func (p Permissions) Include(code string) bool {
@@ -20,20 +34,34 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
+func ValidatePermissionCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) <= 100, "code", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(code, PermissionCodeRX), "code", "must have the format <resource>:<action>")
+}
+
 type PermissionModel struct {
-	DB *sql.DB
+	DB      DBTX
+	timeout time.Duration
 }
 
-func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+// Retrieves the effective permission codes of a user, which are the codes granted
+// directly to the user combined with the codes bundled by the user's roles.
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
 	query := `
 		SELECT permissions.code
 		FROM permissions
 		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-		INNER JOIN users ON users_permissions.user_id = users.id
-		WHERE users.id = $1`
+		WHERE users_permissions.user_id = $1
+		UNION
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+		INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+		WHERE users_roles.user_id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	ctx, done := startQuery(ctx, m.timeout, "PermissionModel.GetAllForUser", query)
+	defer done()
 
 	rows, err := m.DB.QueryContext(ctx, query, userID)
 	if err != nil {
@@ -61,14 +89,97 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	return permissions, nil
 }
 
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	// Codes that are already granted to the user are skipped.
 	query := `
 		INSERT INTO users_permissions
-		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	ctx, done := startQuery(ctx, m.timeout, "PermissionModel.AddForUser", query)
+	defer done()
 
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
+
+// Revokes the given permission codes from a user.
+func (m PermissionModel) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `
+		DELETE FROM users_permissions
+		USING permissions
+		WHERE users_permissions.permission_id = permissions.id
+		AND users_permissions.user_id = $1 AND permissions.code = ANY($2)`
+
+	ctx, done := startQuery(ctx, m.timeout, "PermissionModel.RemoveForUser", query)
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+// Retrieves all existing permissions ordered by code.
+func (m PermissionModel) GetAll(ctx context.Context) ([]*Permission, error) {
+	query := `
+		SELECT id, code
+		FROM permissions
+		ORDER BY code`
+
+	ctx, done := startQuery(ctx, m.timeout, "PermissionModel.GetAll", query)
+	defer done()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*Permission{}
+
+	for rows.Next() {
+		var permission Permission
+
+		err = rows.Scan(&permission.ID, &permission.Code)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, &permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Inserts a new permission and grants it to the admin role, which holds every permission.
+func (m PermissionModel) Insert(ctx context.Context, permission *Permission) error {
+	query := `
+		WITH permission AS (
+			INSERT INTO permissions (code)
+			VALUES ($1)
+			RETURNING id
+		), admin AS (
+			INSERT INTO roles_permissions
+			SELECT roles.id, permission.id FROM roles, permission
+			WHERE roles.name = 'admin'
+		)
+		SELECT id FROM permission`
+
+	ctx, done := startQuery(ctx, m.timeout, "PermissionModel.Insert", query)
+	defer done()
+
+	err := m.DB.QueryRowContext(ctx, query, permission.Code).Scan(&permission.ID)
+	// Explicitly check if the provided code violates the UNIQUE constraint.
+	if err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "permissions_code_key"` {
+			return ErrDuplicatePermission
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Constants for each operation recorded in the revision history of a movie.
+const (
+	RevisionInsert   = "insert"
+	RevisionUpdate   = "update"
+	RevisionRestore  = "restore"  // Update that rolled the movie back to an earlier revision
+	RevisionDelete   = "delete"   // Records the last state of the movie before it was deleted
+	RevisionUndelete = "undelete" // Movie was taken out of the trash again
+	RevisionSnapshot = "snapshot" // State of a movie when the revision history was introduced
+)
+
+// Represents the state of a movie after a change, together with the user who made it.
+type MovieRevision struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Operation string    `json:"operation"`
+	UserID    *int64    `json:"userId"` // Nil if the user has been deleted since
+	Movie     Movie     `json:"movie"`
+}
+
+type MovieRevisionModel struct {
+	DB      DBTX
+	timeout time.Duration
+}
+
+// Records the current state of the movie, it should be called in the same transaction as the change itself.
+func (m MovieRevisionModel) Insert(ctx context.Context, revision *MovieRevision) error {
+	query := `
+		INSERT INTO movie_revisions (movie_id, version, operation, title, year, runtime, genres, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`
+
+	movie := revision.Movie
+	args := []any{movie.ID, movie.Version, revision.Operation, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), revision.UserID}
+
+	ctx, done := startQuery(ctx, m.timeout, "MovieRevisionModel.Insert", query)
+	defer done()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&revision.ID, &revision.CreatedAt)
+}
+
+// Returns the revision which produced the given version of a movie.
+//
+// Delete revisions are skipped, since they repeat the state of the version before the delete.
+func (m MovieRevisionModel) Get(ctx context.Context, movieID int64, version int32) (*MovieRevision, error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, operation, user_id, movie_id, title, year, runtime, genres, version
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version = $2 AND operation <> 'delete'
+		ORDER BY id DESC
+		LIMIT 1`
+
+	ctx, done := startQuery(ctx, m.timeout, "MovieRevisionModel.Get", query)
+	defer done()
+
+	var revision MovieRevision
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.ID,
+		&revision.CreatedAt,
+		&revision.Operation,
+		&revision.UserID,
+		&revision.Movie.ID,
+		&revision.Movie.Title,
+		&revision.Movie.Year,
+		&revision.Movie.Runtime,
+		pq.Array(&revision.Movie.Genres),
+		&revision.Movie.Version,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// Returns a page of the revision history of a movie, sorted by version.
+func (m MovieRevisionModel) GetAllForMovie(ctx context.Context, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	// Revisions sharing a version (an update followed by a delete) are ordered by when they were recorded.
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, operation, user_id, movie_id, title, year, runtime, genres, version
+		FROM movie_revisions
+		WHERE movie_id = $1
+		ORDER BY %[1]s %[2]s, id %[2]s
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, done := startQuery(ctx, m.timeout, "MovieRevisionModel.GetAllForMovie", query)
+	defer done()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		var revision MovieRevision
+
+		err := rows.Scan(
+			&totalRecords,
+			&revision.ID,
+			&revision.CreatedAt,
+			&revision.Operation,
+			&revision.UserID,
+			&revision.Movie.ID,
+			&revision.Movie.Title,
+			&revision.Movie.Year,
+			&revision.Movie.Runtime,
+			pq.Array(&revision.Movie.Genres),
+			&revision.Movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
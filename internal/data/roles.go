@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A role bundles a set of permission codes, which are granted to every user assigned to the role.
+type Role struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type Roles []string
+
+func (r Roles) Include(name string) bool {
+	for i := range r {
+		if r[i] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+type RoleModel struct {
+	DB      DBTX
+	timeout time.Duration
+}
+
+// Retrieves all roles together with the permission codes they bundle.
+func (m RoleModel) GetAll(ctx context.Context) ([]*Role, error) {
+	query := `
+		SELECT roles.id, roles.name, array_remove(array_agg(permissions.code ORDER BY permissions.code), NULL)
+		FROM roles
+		LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+		LEFT JOIN permissions ON roles_permissions.permission_id = permissions.id
+		GROUP BY roles.id
+		ORDER BY roles.id`
+
+	ctx, done := startQuery(ctx, m.timeout, "RoleModel.GetAll", query)
+	defer done()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+
+	for rows.Next() {
+		var role Role
+
+		err = rows.Scan(&role.ID, &role.Name, pq.Array(&role.Permissions))
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, &role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Retrieves the names of the roles assigned to a user.
+func (m RoleModel) GetAllForUser(ctx context.Context, userID int64) (Roles, error) {
+	query := `
+		SELECT roles.name
+		FROM roles
+		INNER JOIN users_roles ON users_roles.role_id = roles.id
+		WHERE users_roles.user_id = $1
+		ORDER BY roles.id`
+
+	ctx, done := startQuery(ctx, m.timeout, "RoleModel.GetAllForUser", query)
+	defer done()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := Roles{}
+
+	for rows.Next() {
+		var role string
+
+		err = rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Assigns the given roles to a user, roles that are already assigned are skipped.
+func (m RoleModel) AddForUser(ctx context.Context, userID int64, names ...string) error {
+	query := `
+		INSERT INTO users_roles
+		SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, done := startQuery(ctx, m.timeout, "RoleModel.AddForUser", query)
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	return err
+}
+
+// Unassigns the given roles from a user.
+func (m RoleModel) RemoveForUser(ctx context.Context, userID int64, names ...string) error {
+	query := `
+		DELETE FROM users_roles
+		USING roles
+		WHERE users_roles.role_id = roles.id
+		AND users_roles.user_id = $1 AND roles.name = ANY($2)`
+
+	ctx, done := startQuery(ctx, m.timeout, "RoleModel.RemoveForUser", query)
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	return err
+}
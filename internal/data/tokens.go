@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
 	"github.com/ricci2511/greenlight-api/internal/validator"
@@ -16,14 +17,36 @@ const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
 	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+)
+
+var (
+	ErrTokenReused = errors.New("token reused")
 )
 
 type Token struct {
+	ID        int64     `json:"-"`
+	CreatedAt time.Time `json:"-"`
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserId    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	Family    []byte    `json:"-"` // Groups the authentication and refresh tokens issued for one login
+	Used      bool      `json:"-"` // Whether a refresh token has already been exchanged
+	IP        string    `json:"-"` // Client IP address the token was issued to
+	UserAgent string    `json:"-"` // Client user agent the token was issued to
+}
+
+// Represents an authentication token from the point of view of its user, i.e. a logged in client.
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"userAgent"`
+	Current    bool       `json:"current"` // Whether the session belongs to the token of the current request
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -52,50 +75,303 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	return token, nil
 }
 
+// Generates a random identifier for a new family of authentication and refresh tokens.
+func NewTokenFamily() ([]byte, error) {
+	family := make([]byte, 16)
+
+	_, err := rand.Read(family)
+	if err != nil {
+		return nil, err
+	}
+
+	return family, nil
+}
+
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
 }
 
 type TokenModel struct {
-	DB *sql.DB
+	DB      DBTX
+	timeout time.Duration
 }
 
 // Helper to generate a new token based on the provided arguments and insert it into the database.
-func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+func (m TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
 
-	err = m.Insert(token)
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+// Same as New(), but the token is added to the given token family and records the client it was issued to.
+func (m TokenModel) NewInFamily(ctx context.Context, userID int64, ttl time.Duration, scope string, family []byte, ip, userAgent string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Family = family
+	token.IP = ip
+	token.UserAgent = userAgent
+
+	err = m.Insert(ctx, token)
 	return token, err
 }
 
 // Adds a new token to the tokens table.
-func (m TokenModel) Insert(token *Token) error {
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
 	query := `
-		INSERT INTO tokens (hash, user_id, expiry, scope)
-		VALUES ($1, $2, $3, $4)`
+		INSERT INTO tokens (hash, user_id, expiry, scope, family, used, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`
 
-	args := []any{token.Hash, token.UserId, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserId, token.Expiry, token.Scope, token.Family, token.Used, token.IP, token.UserAgent}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.Insert", query)
+	defer done()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	// Mutate the passed token struct with the generated id and created_at values.
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&token.ID, &token.CreatedAt)
 }
 
 // Deletes all tokens for a specific user and scope.
-func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
 	query := `
 		DELETE FROM tokens
 		WHERE scope = $1 AND user_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.DeleteAllForUser", query)
+	defer done()
 
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// Retrieves a non-expired token by its plaintext and scope.
+func (m TokenModel) GetByPlaintext(ctx context.Context, scope, tokenPlaintext string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT hash, user_id, expiry, scope, family, used
+		FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > $3`
+
+	args := []any{tokenHash[:], scope, time.Now()}
+
+	var token Token
+
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.GetByPlaintext", query)
+	defer done()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&token.Hash,
+		&token.UserId,
+		&token.Expiry,
+		&token.Scope,
+		&token.Family,
+		&token.Used,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	token.Plaintext = tokenPlaintext
+
+	return &token, nil
+}
+
+// Marks a refresh token as used, so that any further attempt to exchange it is detected as reuse.
+//
+// Returns ErrTokenReused if the token was already used, e.g. by a concurrent request.
+func (m TokenModel) MarkUsed(ctx context.Context, token *Token) error {
+	query := `
+		UPDATE tokens
+		SET used = true
+		WHERE hash = $1 AND used = false`
+
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.MarkUsed", query)
+	defer done()
+
+	result, err := m.DB.ExecContext(ctx, query, token.Hash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTokenReused
+	}
+
+	token.Used = true
+
+	return nil
+}
+
+// Deletes a single token.
+func (m TokenModel) Delete(ctx context.Context, token *Token) error {
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1`
+
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.Delete", query)
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, query, token.Hash)
+	return err
+}
+
+// Deletes all tokens of a specific scope that belong to a token family.
+func (m TokenModel) DeleteAllForFamily(ctx context.Context, scope string, family []byte) error {
+	query := `
+		DELETE FROM tokens
+		WHERE scope = $1 AND family = $2`
+
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.DeleteAllForFamily", query)
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, query, scope, family)
+	return err
+}
+
+// Deletes every token that belongs to a token family, revoking the login it was issued for.
+func (m TokenModel) DeleteFamily(ctx context.Context, family []byte) error {
+	query := `
+		DELETE FROM tokens
+		WHERE family = $1`
+
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.DeleteFamily", query)
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, query, family)
+	return err
+}
+
+// Records that an authentication token has just been used.
+//
+// To avoid a write on every request, the last used time is only updated once per minute.
+func (m TokenModel) Touch(ctx context.Context, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		UPDATE tokens
+		SET last_used_at = $2
+		WHERE hash = $1 AND (last_used_at IS NULL OR last_used_at < $2 - INTERVAL '1 minute')`
+
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.Touch", query)
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, query, tokenHash[:], time.Now())
+	return err
+}
+
+// Retrieves the non-expired authentication tokens of a user as sessions, most recently created first.
+//
+// The session belonging to the given token plaintext is flagged as the current one.
+func (m TokenModel) GetAllSessionsForUser(ctx context.Context, userID int64, currentTokenPlaintext string) ([]*Session, error) {
+	currentHash := sha256.Sum256([]byte(currentTokenPlaintext))
+
+	query := `
+		SELECT id, created_at, last_used_at, expiry, ip, user_agent, hash = $3
+		FROM tokens
+		WHERE user_id = $1 AND scope = $2 AND expiry > $4
+		ORDER BY created_at DESC, id DESC`
+
+	args := []any{userID, ScopeAuthentication, currentHash[:], time.Now()}
+
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.GetAllSessionsForUser", query)
+	defer done()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		var session Session
+
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.IP,
+			&session.UserAgent,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Deletes a session of a user, together with the refresh tokens of its token family.
+func (m TokenModel) DeleteSessionForUser(ctx context.Context, userID, sessionID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND (
+			(id = $2 AND scope = $3)
+			OR family = (SELECT family FROM tokens WHERE id = $2 AND user_id = $1 AND scope = $3)
+		)`
+
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.DeleteSessionForUser", query)
+	defer done()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, sessionID, ScopeAuthentication)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Deletes all expired tokens of every scope, returning the number of deleted tokens.
+func (m TokenModel) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM tokens
+		WHERE expiry <= $1`
+
+	ctx, done := startQuery(ctx, m.timeout, "TokenModel.DeleteExpired", query)
+	defer done()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,33 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/ricci2511/greenlight-api/internal/data")
+
+// Starts a client span for a query made by a model method, named after the model and method, and bounds
+// the query by the model's timeout, in addition to any deadline of the caller's context.
+//
+// The caller must call the returned function once the query has completed, which ends the span.
+func startQuery(ctx context.Context, timeout time.Duration, name, query string) (context.Context, func()) {
+	ctx, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBStatement(query),
+		),
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	return ctx, func() {
+		cancel()
+		span.End()
+	}
+}
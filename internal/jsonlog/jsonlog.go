@@ -1,71 +1,140 @@
 package jsonlog
 
 import (
+	"context"
 	"encoding/json"
 	"io"
+	"log/slog"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 )
 
-// Represents the log entry severity level.
-type Level int8
-
+// Log entry severity levels, based on the log/slog levels with an additional FATAL level.
 const (
-	LevelInfo  Level = iota // 0
-	LevelError              // 1
-	LevelFatal              // 2
-	LevelOff                // 3
+	LevelDebug = slog.LevelDebug // -4
+	LevelInfo  = slog.LevelInfo  // 0
+	LevelWarn  = slog.LevelWarn  // 4
+	LevelError = slog.LevelError // 8
+	LevelFatal = slog.Level(12)
+	LevelOff   = slog.Level(16)
 )
 
 // Returns human readable string based on the log severity level.
-func (l Level) String() string {
-	switch l {
-	case LevelInfo:
-		return "INFO"
-	case LevelError:
-		return "ERROR"
-	case LevelFatal:
+func levelString(l slog.Level) string {
+	switch {
+	case l >= LevelOff:
+		return ""
+	case l >= LevelFatal:
 		return "FATAL"
+	case l >= LevelError:
+		return "ERROR"
+	case l >= LevelWarn:
+		return "WARN"
+	case l >= LevelInfo:
+		return "INFO"
 	default:
-		return ""
+		return "DEBUG"
 	}
 }
 
-type Logger struct {
-	out      io.Writer  // Output destination for the log entry
-	minLevel Level      // Minimum level to log
-	mu       sync.Mutex // Ensures atomic log writes
+// Parses a level name like "debug" or "WARN", in addition to the names understood by slog.Level
+// it also accepts "fatal" and "off".
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToUpper(s) {
+	case "FATAL":
+		return LevelFatal, nil
+	case "OFF":
+		return LevelOff, nil
+	}
+
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+
+	return level, err
+}
+
+type contextKey string
+
+const requestIDContextKey = contextKey("requestID")
+
+// Returns a copy of the context carrying the request ID, which Handler adds to every entry logged with it.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+// Returns the request ID stored in the context, or an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
+
+type HandlerOptions struct {
+	Level slog.Leveler // Minimum level to log, defaults to LevelInfo
+	Trace bool         // Include a stack trace in ERROR and FATAL log entries
+}
+
+// Implementation of slog.Handler which writes every record as a JSON line in the format:
+//
+//	{"level":"INFO","time":"...","message":"...","properties":{...},"trace":"..."}
+type Handler struct {
+	out    io.Writer // Output destination for the log entry
+	opts   HandlerOptions
+	attrs  map[string]any // Attributes added through WithAttrs()
+	groups []string       // Groups added through WithGroup(), in order of nesting
+	mu     *sync.Mutex    // Ensures atomic log writes, shared by all handlers derived from the same one
+}
+
+// Returns a new Handler writing to the given output destination.
+func NewHandler(out io.Writer, opts *HandlerOptions) *Handler {
+	h := &Handler{out: out, attrs: map[string]any{}, mu: &sync.Mutex{}}
+
+	if opts != nil {
+		h.opts = *opts
+	}
+
+	if h.opts.Level == nil {
+		h.opts.Level = LevelInfo
+	}
+
+	return h
 }
 
-// Returns new Logger instance with the given output destination and minimum log level.
-func New(out io.Writer, minLevel Level) *Logger {
-	return &Logger{out: out, minLevel: minLevel}
+// Ignore log entries with a severity level below the minimum set.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level() && level < LevelOff
 }
 
-// Internal jsonlog method to write a log entry to the output destination.
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	// Ignore log entries with a severity level below the minimum set.
-	if level < l.minLevel {
-		return 0, nil
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	properties := cloneProperties(h.attrs)
+
+	// Entries logged with a request context can be matched to the request, e.g. through the X-Request-ID header.
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		properties["requestID"] = requestID
 	}
 
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(properties, h.groups, a)
+		return true
+	})
+
 	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
+		Level      string         `json:"level"`
+		Time       string         `json:"time"`
+		Message    string         `json:"message"`
+		Properties map[string]any `json:"properties,omitempty"`
+		Trace      string         `json:"trace,omitempty"`
 	}{
-		Level:      level.String(),
-		Time:       time.Now().UTC().Format(time.RFC3339),
-		Message:    message,
+		Level:      levelString(r.Level),
+		Time:       r.Time.UTC().Format(time.RFC3339),
+		Message:    r.Message,
 		Properties: properties,
 	}
 
-	// Only include stack trace info for error and fatal log entries.
-	if level >= LevelError {
+	// Optionally include stack trace info for error and fatal log entries.
+	if h.opts.Trace && r.Level >= LevelError {
 		aux.Trace = string(debug.Stack())
 	}
 
@@ -74,29 +143,140 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 	// Marshal log entry to JSON. If it fails, fallback to a simple string message.
 	line, err := json.Marshal(aux)
 	if err != nil {
-		line = []byte(LevelError.String() + ": failed to marshal log message: " + err.Error())
+		line = []byte(levelString(LevelError) + ": failed to marshal log message: " + err.Error())
 	}
 
 	// Prevent multiple log entries from being written over each other.
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err = h.out.Write(append(line, '\n'))
+	return err
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = cloneProperties(h.attrs)
+
+	for _, a := range attrs {
+		addAttr(h2.attrs, h.groups, a)
+	}
+
+	return &h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.groups = append(append([]string{}, h.groups...), name)
+
+	return &h2
+}
+
+// Adds an attribute to the properties, nested inside the given groups.
+func addAttr(properties map[string]any, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+
+	// Attributes without a key or value are ignored, as documented by slog.Handler.
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	for _, group := range groups {
+		nested, ok := properties[group].(map[string]any)
+		if !ok {
+			nested = map[string]any{}
+			properties[group] = nested
+		}
+
+		properties = nested
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		groupAttrs := a.Value.Group()
+		if len(groupAttrs) == 0 {
+			return
+		}
+
+		// Attributes of a group without a key are inlined, as documented by slog.Handler.
+		var nestedGroups []string
+		if a.Key != "" {
+			nestedGroups = []string{a.Key}
+		}
+
+		for _, ga := range groupAttrs {
+			addAttr(properties, nestedGroups, ga)
+		}
+	case slog.KindTime:
+		properties[a.Key] = a.Value.Time().UTC().Format(time.RFC3339)
+	case slog.KindDuration:
+		properties[a.Key] = a.Value.Duration().String()
+	default:
+		value := a.Value.Any()
+
+		// Errors don't marshal to anything useful, so use their message instead.
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+
+		properties[a.Key] = value
+	}
+}
+
+// Returns a deep copy of the properties, so that derived handlers don't share nested groups.
+func cloneProperties(properties map[string]any) map[string]any {
+	clone := make(map[string]any, len(properties))
+
+	for key, value := range properties {
+		if nested, ok := value.(map[string]any); ok {
+			value = cloneProperties(nested)
+		}
+
+		clone[key] = value
+	}
+
+	return clone
+}
+
+// Logger with helpers that keep the original jsonlog API, while all other slog.Logger methods
+// like Debug() and Warn() can be used with typed attributes.
+type Logger struct {
+	*slog.Logger
+}
+
+// Returns new Logger instance with the given output destination and handler options.
+func New(out io.Writer, opts *HandlerOptions) *Logger {
+	return &Logger{Logger: slog.New(NewHandler(out, opts))}
+}
+
+// Converts string properties to slog attributes.
+func propertiesToAttrs(properties map[string]string) []any {
+	attrs := make([]any, 0, len(properties))
+
+	for key, value := range properties {
+		attrs = append(attrs, slog.String(key, value))
+	}
 
-	return l.out.Write(append(line, '\n'))
+	return attrs
 }
 
 // Helper to write a log entry with the INFO severity level.
 func (l *Logger) PrintInfo(message string, data map[string]string) {
-	l.print(LevelInfo, message, data)
+	l.Info(message, propertiesToAttrs(data)...)
 }
 
 // Helper to write a log entry with the ERROR severity level.
 func (l *Logger) PrintError(err error, data map[string]string) {
-	l.print(LevelError, err.Error(), data)
+	l.Error(err.Error(), propertiesToAttrs(data)...)
 }
 
 // Helper to write a log entry with the FATAL severity level.
 func (l *Logger) PrintFatal(err error, data map[string]string) {
-	l.print(LevelFatal, err.Error(), data)
+	l.Log(context.Background(), LevelFatal, err.Error(), propertiesToAttrs(data)...)
 	os.Exit(1) // FATAL errors should terminate the application
 }
 
@@ -104,5 +284,6 @@ func (l *Logger) PrintFatal(err error, data map[string]string) {
 //
 // This is used by http.Server.ErrorLog to write HTTP server errors to our jsonlog.
 func (l *Logger) Write(message []byte) (n int, err error) {
-	return l.print(LevelError, string(message), nil)
+	l.Error(strings.TrimSuffix(string(message), "\n"))
+	return len(message), nil
 }
@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Transport that writes every message as an .eml file into a directory instead of sending it.
+//
+// Useful for local development, the files can be opened with any email client.
+type FileTransport struct {
+	dir string
+}
+
+// Returns a new FileTransport writing into dir, which is created if it doesn't exist yet.
+func NewFileTransport(dir string) (*FileTransport, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileTransport{dir: dir}, nil
+}
+
+func (t *FileTransport) Send(msg *Message) error {
+	// Random suffix to prevent messages written in the same nanosecond from overwriting each other.
+	suffix := make([]byte, 4)
+
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+
+	f, err := os.Create(filepath.Join(t.dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = msg.mimeMessage().WriteTo(f)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// Verifies that the outbox directory still exists.
+func (t *FileTransport) Check(ctx context.Context) error {
+	info, err := os.Stat(t.dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", t.dir)
+	}
+
+	return nil
+}
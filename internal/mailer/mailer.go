@@ -2,32 +2,91 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"html/template"
-	"time"
 
 	"github.com/go-mail/mail/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 //go:embed "templates"
 var templateFS embed.FS
 
-type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+var tracer = otel.Tracer("github.com/ricci2511/greenlight-api/internal/mailer")
+
+// Represents a rendered email ready to be delivered by a Transport.
+type Message struct {
+	From      string
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Builds the MIME message for a Message, with the HTML body as an alternative to the plain text one.
+func (msg *Message) mimeMessage() *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("From", msg.From)
+	m.SetHeader("To", msg.To)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+
+	return m
+}
+
+// Delivers rendered messages, e.g. through an SMTP server or by writing them to disk.
+type Transport interface {
+	Send(msg *Message) error
+}
+
+// Optionally implemented by transports that can verify they are able to deliver messages.
+type Checker interface {
+	Check(ctx context.Context) error
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
+type Mailer struct {
+	transport Transport
+	sender    string
+}
 
+func New(transport Transport, sender string) Mailer {
 	return Mailer{
-		dialer: dialer,
-		sender: sender,
+		transport: transport,
+		sender:    sender,
+	}
+}
+
+// Renders the template with the given data and sends it to the recipient through the mail transport.
+func (m Mailer) Send(ctx context.Context, recipient, templateFile string, data any) error {
+	_, span := tracer.Start(ctx, "Mailer.Send")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("mail.template", templateFile))
+
+	err := m.send(recipient, templateFile, data)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// Checks that the mail transport is usable, transports that don't implement Checker are always healthy.
+func (m Mailer) Check(ctx context.Context) error {
+	checker, ok := m.transport.(Checker)
+	if !ok {
+		return nil
 	}
+
+	return checker.Check(ctx)
 }
 
-func (m Mailer) Send(recipient, templateFile string, data any) error {
+func (m Mailer) send(recipient, templateFile string, data any) error {
 	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
 	if err != nil {
 		return err
@@ -51,23 +110,13 @@ func (m Mailer) Send(recipient, templateFile string, data any) error {
 		return err
 	}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
-
-	// Retry sending the email a maximum of 3 times at intervals of 500ms.
-	for i := 0; i < 3; i++ {
-		err = m.dialer.DialAndSend(msg)
-		// If sending succeeds, return early.
-		if nil == err {
-			return nil
-		}
-
-		time.Sleep(500 * time.Millisecond)
+	msg := &Message{
+		From:      m.sender,
+		To:        recipient,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
 	}
 
-	return err
+	return m.transport.Send(msg)
 }
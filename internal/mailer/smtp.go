@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// Transport that delivers messages through an SMTP server.
+type SMTPTransport struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTPTransport(host string, port int, username, password string) *SMTPTransport {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPTransport{dialer: dialer}
+}
+
+// Sends the message with a single attempt, retries are left to the caller.
+func (t *SMTPTransport) Send(msg *Message) error {
+	return t.dialer.DialAndSend(msg.mimeMessage())
+}
+
+// Dials the SMTP server and authenticates without sending anything.
+func (t *SMTPTransport) Check(ctx context.Context) error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		conn, err := t.dialer.Dial()
+		if err == nil {
+			err = conn.Close()
+		}
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,4 @@
+-- Composite indexes backing keyset (cursor) pagination, which sorts by a column and breaks ties by id.
+CREATE INDEX IF NOT EXISTS movies_title_id_idx ON movies (title, id);
+CREATE INDEX IF NOT EXISTS movies_year_id_idx ON movies (year, id);
+CREATE INDEX IF NOT EXISTS movies_runtime_id_idx ON movies (runtime, id);
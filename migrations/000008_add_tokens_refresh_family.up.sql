@@ -0,0 +1,5 @@
+-- Tokens issued together on login share a family, so a reused refresh token can revoke the whole chain.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family bytea;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS used bool NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS tokens_family_idx ON tokens (family);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS outbox_emails (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    recipient text NOT NULL,
+    template text NOT NULL,
+    data jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_error text NOT NULL DEFAULT '',
+    sent_at timestamp(0) with time zone
+);
+
+-- The delivery worker only ever looks for pending emails that are due.
+CREATE INDEX IF NOT EXISTS outbox_emails_pending_idx ON outbox_emails (next_attempt_at) WHERE status = 'pending';
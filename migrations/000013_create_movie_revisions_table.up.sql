@@ -0,0 +1,20 @@
+-- Revisions are kept after their movie is deleted, so movie_id deliberately has no foreign key.
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    movie_id bigint NOT NULL,
+    version integer NOT NULL,
+    operation text NOT NULL,
+    title text NOT NULL,
+    year integer NOT NULL,
+    runtime integer NOT NULL,
+    genres text[] NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_id_version_idx ON movie_revisions (movie_id, version);
+
+-- Keep the current state of existing movies, so their first update can still be rolled back.
+INSERT INTO movie_revisions (movie_id, version, operation, title, year, runtime, genres)
+SELECT id, version, 'snapshot', title, year, runtime, genres
+FROM movies;
@@ -0,0 +1,8 @@
+DELETE FROM permissions WHERE code = 'movies:admin';
+
+-- Deleted movies can't be told apart from the others once the column is gone.
+DELETE FROM movies WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS movies_deleted_at_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,14 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+-- Only the trash listing and the purge job look up deleted movies.
+CREATE INDEX IF NOT EXISTS movies_deleted_at_idx ON movies (deleted_at) WHERE deleted_at IS NOT NULL;
+
+INSERT INTO permissions (code)
+VALUES ('movies:admin')
+ON CONFLICT (code) DO NOTHING;
+
+-- Admins get every permission, including the new one.
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'movies:admin'
+ON CONFLICT DO NOTHING;
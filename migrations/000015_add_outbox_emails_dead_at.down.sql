@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS outbox_emails_dead_at_idx;
+
+ALTER TABLE outbox_emails DROP COLUMN IF EXISTS dead_at;
@@ -0,0 +1,7 @@
+ALTER TABLE outbox_emails ADD COLUMN IF NOT EXISTS dead_at timestamp(0) with time zone;
+
+-- Dead letters kept so far never got a timestamp, so their retention starts now.
+UPDATE outbox_emails SET dead_at = NOW(), data = '{}' WHERE status = 'dead';
+
+-- Only the purge job looks up dead letters.
+CREATE INDEX IF NOT EXISTS outbox_emails_dead_at_idx ON outbox_emails (dead_at) WHERE status = 'dead';
@@ -0,0 +1,2 @@
+-- Only the purge job looks up sent emails by delivery time.
+CREATE INDEX IF NOT EXISTS outbox_emails_sent_at_idx ON outbox_emails (sent_at) WHERE status = 'sent';
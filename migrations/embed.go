@@ -0,0 +1,7 @@
+// Package migrations embeds the SQL migration files so they ship inside the api binary.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS